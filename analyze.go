@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type phaseSummary struct {
+	name                string
+	sentRequests        int
+	getItemsErrors      int
+	buyItemsErrors      int
+	droppedIterations   int
+	averageResponseTime time.Duration
+	percentiles         []time.Duration
+
+	correctedAverageResponseTime time.Duration
+	correctedPercentiles         []time.Duration
+}
+
+func samplesPathArgument(name, arguments string, commandArguments []string, pathsNum int,
+	defineFlags func(flags *flag.FlagSet)) ([]string, error) {
+
+	flags := newFlagSet(name, arguments)
+	if defineFlags != nil {
+		defineFlags(flags)
+	}
+	logDir := flags.String("logs", "./logs", "directory with the Samples.log of a run")
+	percentiles := flags.String("percentiles", formatPercentiles(reportPercentiles), "comma-separated percentiles to report")
+	if err := flags.Parse(commandArguments); err != nil {
+		return nil, err
+	}
+
+	parsedPercentiles, err := parsePercentiles(*percentiles)
+	if err != nil {
+		return nil, err
+	}
+	reportPercentiles = parsedPercentiles
+
+	paths := flags.Args()
+	if len(paths) == 0 && pathsNum == 1 {
+		paths = []string{filepath.Join(*logDir, "Samples.log")}
+	}
+	if len(paths) != pathsNum {
+		flags.Usage()
+		return nil, fmt.Errorf("%s expects %d samples files, got %d", name, pathsNum, len(paths))
+	}
+	return paths, nil
+}
+
+func analyzeCommand(arguments []string) error {
+	var reports *string
+	var htmlReport *bool
+	paths, err := samplesPathArgument("analyze", "[samples file]", arguments, 1, func(flags *flag.FlagSet) {
+		reports = flags.String("report", "text",
+			"comma-separated report formats written next to the samples file: "+strings.Join(supportedReportFormats, ", "))
+		htmlReport = flags.Bool("html", false, "also write a self-contained Report.html with charts")
+	})
+	if err != nil {
+		return err
+	}
+
+	if reportFormats, err = parseReportFormats(*reports); err != nil {
+		return err
+	}
+	if *htmlReport {
+		reportFormats["html"] = true
+	}
+
+	Init()
+
+	reportMetadata = runMetadata{Command: "analyze", SamplesFile: paths[0]}
+
+	err = readSamples(paths[0], func(record sampleRecord) {
+		if reportMetadata.StartTime.IsZero() || record.time.Before(reportMetadata.StartTime) {
+			reportMetadata.StartTime = record.time
+		}
+		if record.time.After(reportMetadata.EndTime) {
+			reportMetadata.EndTime = record.time
+		}
+
+		switch record.kind {
+		case sampleKindPhase:
+			startPhaseStats(record.message, record.time)
+			logStat.Printf("[MAIN] %s has been started", record.message)
+		case sampleKindDone:
+			currentPhaseStats.endTime = record.time
+		case sampleKindStat:
+			currentPhaseStats.showStat = true
+			if reportFormats["text"] {
+				logStat.Printf("[MAIN] %s statistics:", record.message)
+				showStat()
+			}
+		case sampleKindResponse:
+			currentPhaseStats.sentRequestsCount++
+			if record.message == "" {
+				currentPhaseStats.recordResponseTime(record.endpoint, record.responseTime())
+			}
+		case sampleKindError:
+			currentPhaseStats.recordError(record.endpoint, record.errResponse())
+		case sampleKindDropped:
+			currentPhaseStats.droppedIterationsCount++
+		case sampleKindJourney:
+			currentPhaseStats.recordJourney(record.message, record.elapsed, record.errorClass)
+		case sampleKindUserState:
+			currentPhaseStats.recordUserState(record.message, record.elapsed, record.dwellTime, record.errorClass)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeReports(filepath.Dir(paths[0]))
+}
+
+func compareCommand(arguments []string) error {
+	paths, err := samplesPathArgument("compare", "baseline candidate", arguments, 2, nil)
+	if err != nil {
+		return err
+	}
+
+	baselineSummaries, err := summarizeSamples(paths[0])
+	if err != nil {
+		return err
+	}
+	candidateSummaries, err := summarizeSamples(paths[1])
+	if err != nil {
+		return err
+	}
+
+	output := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer output.Flush()
+
+	fmt.Fprintf(output, "Baseline:\t%s\n", paths[0])
+	fmt.Fprintf(output, "Candidate:\t%s\n", paths[1])
+
+	for _, baseline := range baselineSummaries {
+		var candidate *phaseSummary
+		for index := range candidateSummaries {
+			if candidateSummaries[index].name == baseline.name {
+				candidate = &candidateSummaries[index]
+				break
+			}
+		}
+
+		fmt.Fprintf(output, "\n%s\n", baseline.name)
+		if candidate == nil {
+			fmt.Fprintln(output, "Phase is missing in the candidate run")
+			continue
+		}
+
+		fmt.Fprintln(output, "Metric\tBaseline\tCandidate\tChange")
+		printComparison(output, "Sent requests", float64(baseline.sentRequests), float64(candidate.sentRequests), "%.0f")
+		printComparison(output, "Get items errors",
+			float64(baseline.getItemsErrors), float64(candidate.getItemsErrors), "%.0f")
+		printComparison(output, "Buy items errors",
+			float64(baseline.buyItemsErrors), float64(candidate.buyItemsErrors), "%.0f")
+		printComparison(output, "Dropped iterations",
+			float64(baseline.droppedIterations), float64(candidate.droppedIterations), "%.0f")
+		printComparison(output, "Average response time, ms",
+			milliseconds(baseline.averageResponseTime), milliseconds(candidate.averageResponseTime), "%.3f")
+		for index, percentile := range reportPercentiles {
+			printComparison(output, "Response time "+percentileLabel(percentile)+", ms",
+				milliseconds(baseline.percentiles[index]), milliseconds(candidate.percentiles[index]), "%.3f")
+		}
+		printComparison(output, "Corrected average response time, ms",
+			milliseconds(baseline.correctedAverageResponseTime), milliseconds(candidate.correctedAverageResponseTime), "%.3f")
+		for index, percentile := range reportPercentiles {
+			printComparison(output, "Corrected response time "+percentileLabel(percentile)+", ms",
+				milliseconds(baseline.correctedPercentiles[index]), milliseconds(candidate.correctedPercentiles[index]), "%.3f")
+		}
+	}
+
+	return nil
+}
+
+func printComparison(output *tabwriter.Writer, metric string, baseline, candidate float64, valueFormat string) {
+	change := "n/a"
+	if baseline != 0 {
+		change = fmt.Sprintf("%+.1f%%", (candidate-baseline)/baseline*100)
+	}
+
+	fmt.Fprintf(output, "%s\t"+valueFormat+"\t"+valueFormat+"\t%s\n", metric, baseline, candidate, change)
+}
+
+func summarizeSamples(path string) ([]phaseSummary, error) {
+	var summaries []phaseSummary
+	stats := newPhaseStats("", time.Time{})
+
+	err := readSamples(path, func(record sampleRecord) {
+		switch record.kind {
+		case sampleKindPhase:
+			stats = newPhaseStats(record.message, record.time)
+		case sampleKindStat:
+			summaries = append(summaries, stats.summary())
+		case sampleKindResponse:
+			stats.sentRequestsCount++
+			if record.message == "" {
+				stats.recordResponseTime(record.endpoint, record.responseTime())
+			}
+		case sampleKindError:
+			stats.recordError(record.endpoint, record.errResponse())
+		case sampleKindDropped:
+			stats.droppedIterationsCount++
+		case sampleKindJourney:
+			stats.recordJourney(record.message, record.elapsed, record.errorClass)
+		case sampleKindUserState:
+			stats.recordUserState(record.message, record.elapsed, record.dwellTime, record.errorClass)
+		}
+	})
+
+	return summaries, err
+}
+
+func (stats *phaseStats) summary() phaseSummary {
+	allRequestsStats := stats.allEndpoints()
+
+	summary := phaseSummary{
+		name:                stats.name,
+		sentRequests:        int(stats.sentRequestsCount),
+		getItemsErrors:      stats.endpoint("/").errorsCount(),
+		buyItemsErrors:      stats.endpoint("/buy").errorsCount(),
+		droppedIterations:   int(stats.droppedIterationsCount),
+		averageResponseTime: allRequestsStats.responseTime.mean(),
+
+		correctedAverageResponseTime: allRequestsStats.correctedResponseTime.mean(),
+	}
+
+	for _, percentile := range reportPercentiles {
+		summary.percentiles = append(summary.percentiles, allRequestsStats.responseTime.valueAtPercentile(percentile))
+		summary.correctedPercentiles = append(summary.correctedPercentiles,
+			allRequestsStats.correctedResponseTime.valueAtPercentile(percentile))
+	}
+
+	return summary
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultBacklogDuration is how many seconds of iterations may wait for an idle virtual user by default
+const defaultBacklogDuration = 10
+
+type arrivalRateIteration struct {
+	number       int
+	intendedTime time.Time
+}
+
+// schedule returns the schedule of an iteration picked up from the backlog at dequeueTime
+func (iteration arrivalRateIteration) schedule(dequeueTime time.Time) messageSchedule {
+	lateness := dequeueTime.Sub(iteration.intendedTime)
+	if lateness < 0 {
+		lateness = 0
+	}
+	return messageSchedule{lateness: lateness}
+}
+
+func runArrivalRate(phase Phase, wg *sync.WaitGroup) {
+	maxBacklog := phase.MaxBacklog
+	if maxBacklog == 0 {
+		maxBacklog = int(phase.Rate * defaultBacklogDuration)
+	}
+
+	// Late iterations wait in the channel buffer and carry the time they waited into every request they send,
+	// so a stalled server shows in the corrected response time
+	iterations := make(chan arrivalRateIteration, localWorker.share(maxBacklog))
+
+	testClientsNum = phase.MaxInFlight
+	virtualUsersNum := localWorker.share(phase.MaxInFlight)
+
+	for currentClientNumber := 0; currentClientNumber < virtualUsersNum; currentClientNumber++ {
+		wg.Add(1)
+
+		currentClientName := requestClientNames[random.Intn(len(requestClientNames))]
+
+		queryParams, contentType, requestBody := makeRequestParams(currentClientName)
+		clientRandom := rand.New(rand.NewSource(random.Int63()))
+
+		go startArrivalRateClient(currentClientName, queryParams, contentType, requestBody, currentClientNumber,
+			clientRandom, wg, iterations)
+	}
+
+	// Workers of a distributed run interleave their iterations, so together they keep the phase rate
+	iterationInterval := time.Duration(float64(time.Second) * float64(localWorker.count) / phase.Rate)
+	startTime := time.Now().Add(time.Duration(float64(time.Second) * float64(localWorker.index) / phase.Rate))
+	endTime := startTime.Add(time.Duration(phase.Duration))
+
+	for iterationNumber := 0; ; iterationNumber++ {
+		intendedTime := startTime.Add(time.Duration(iterationNumber) * iterationInterval)
+		if !intendedTime.Before(endTime) {
+			break
+		}
+
+		if waitTime := time.Until(intendedTime); waitTime > 0 {
+			time.Sleep(waitTime)
+		}
+
+		select {
+		case iterations <- arrivalRateIteration{number: iterationNumber, intendedTime: intendedTime}:
+		default:
+			atomic.AddUint32(&currentPhaseStats.droppedIterationsCount, 1)
+			writeSample(sampleRecord{kind: sampleKindDropped, time: intendedTime})
+		}
+	}
+	close(iterations)
+
+	if droppedIterationsCount := atomic.LoadUint32(&currentPhaseStats.droppedIterationsCount); droppedIterationsCount > 0 {
+		logStat.Printf("[MAIN] %d iterations were dropped: all %d virtual users were busy and the backlog was full",
+			droppedIterationsCount, virtualUsersNum)
+	}
+}
+
+func startArrivalRateClient(userName, queryParam, contentType, body string, currentClientNumber int,
+	clientRandom *rand.Rand, wg *sync.WaitGroup, iterations <-chan arrivalRateIteration) {
+
+	defer wg.Done()
+
+	liveMetrics.clientStarted()
+	defer liveMetrics.clientFinished()
+
+	for iteration := range iterations {
+		schedule := iteration.schedule(time.Now())
+
+		sendClientMessage(userName, queryParam, contentType, body, currentClientNumber, iteration.number, clientRandom,
+			schedule)
+	}
+}
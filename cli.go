@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const usage = `Usage:
+  start_testing [run] [flags]                      run a load test against a server
+  start_testing analyze [flags] [samples file]     print statistics of a recorded run
+  start_testing compare [flags] baseline candidate compare two recorded runs
+  start_testing serve-mock [flags]                 serve a reference implementation of the tested shop
+  start_testing worker [flags]                     generate load on behalf of a "run -workers" coordinator
+
+Run "start_testing <command> -h" for the flags of a command.
+`
+
+var (
+	supportedReportFormats = []string{"text", "json", "csv", "xlsx", "html"}
+	reportFormats          = map[string]bool{"text": true}
+
+	logFiles []*os.File
+)
+
+type command struct {
+	name string
+	run  func(arguments []string) error
+}
+
+var commands = []command{
+	{name: "run", run: runCommand},
+	{name: "analyze", run: analyzeCommand},
+	{name: "compare", run: compareCommand},
+	{name: "serve-mock", run: serveMockCommand},
+	{name: "worker", run: workerCommand},
+}
+
+func main() {
+	arguments := os.Args[1:]
+
+	commandName := "run"
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		commandName, arguments = arguments[0], arguments[1:]
+	}
+
+	for _, currentCommand := range commands {
+		if currentCommand.name == commandName {
+			if err := currentCommand.run(arguments); err != nil {
+				if err == flag.ErrHelp {
+					os.Exit(2)
+				}
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", commandName, usage)
+	os.Exit(2)
+}
+
+func newFlagSet(name, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: start_testing %s [flags] %s\n\nFlags:\n", name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func runCommand(arguments []string) error {
+	flags := newFlagSet("run", "")
+	targetUrl := flags.String("url", serverUrl, "base URL of the tested server")
+	logDir := flags.String("logs", "./logs", "directory for Info.log, Error.log, Stat.log and Samples.log")
+	scenarioPath := flags.String("scenario", "", "path to a JSON scenario file (default: built-in scenario)")
+	seed := flags.Int64("seed", 0, "seed of the random generator, 0 picks a random seed")
+	reports := flags.String("report", "text", "comma-separated report formats: "+strings.Join(supportedReportFormats, ", "))
+	htmlReport := flags.Bool("html", false, "also write a self-contained Report.html with charts")
+	recordSamples := flags.Bool("samples", true, "record raw samples to Samples.log for analyze and compare")
+	percentiles := flags.String("percentiles", formatPercentiles(reportPercentiles), "comma-separated percentiles to report")
+	workers := flags.String("workers", "", "comma-separated host:port addresses of workers to split the load between")
+	dashboardMode := flags.String("dashboard", dashboardAuto,
+		"live dashboard on stdout: auto (tui on a terminal, plain otherwise), tui, plain or off")
+	webAddress := flags.String("web", "", "address to serve the live web dashboard and Prometheus /metrics on, such as :8081 (default: disabled)")
+	influxUrl := flags.String("influx", "",
+		"InfluxDB line protocol destination: a write URL such as http://localhost:8086/write?db=loadtest or udp://host:8089")
+	graphiteAddress := flags.String("graphite", "", "host:port of a Graphite plaintext TCP listener")
+	graphitePrefix := flags.String("graphite-prefix", "load_generator", "prefix of the Graphite metric names")
+	statsdAddress := flags.String("statsd", "", "host:port of a StatsD UDP listener")
+	statsdPrefix := flags.String("statsd-prefix", "load_generator", "prefix of the StatsD metric names")
+	dogStatsd := flags.Bool("dogstatsd", false, "send DogStatsD tags instead of putting them into the StatsD metric names")
+	statsdSampleRate := flags.Float64("statsd-sample-rate", 1, "fraction of the response times sent as StatsD timers")
+	otlpEndpoint := flags.String("otlp", "",
+		"OTLP/HTTP traces endpoint to export a span per request to, such as http://localhost:4318/v1/traces")
+	metricsInterval := flags.Duration("metrics-interval", 10*time.Second, "flush interval of the InfluxDB, Graphite and StatsD metrics")
+	startDelay := flags.Duration("start-delay", 2*time.Second, "time given to the workers to start each phase together")
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	if *workers != "" {
+		if incompatibleFlags := workerIncompatibleFlags(flags); len(incompatibleFlags) > 0 {
+			return fmt.Errorf("%s cannot be used with -workers: the live dashboards, metrics sinks and span exporter "+
+				"only watch the requests of a local run", strings.Join(incompatibleFlags, ", "))
+		}
+	}
+
+	if err := setServerUrl(*targetUrl); err != nil {
+		return err
+	}
+
+	if err := parseDashboardMode(*dashboardMode); err != nil {
+		return err
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	if *metricsInterval <= 0 {
+		return errors.New("-metrics-interval must be positive")
+	}
+	var sinks []metricsSink
+	if *influxUrl != "" {
+		sink, err := newInfluxSink(*influxUrl)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if *graphiteAddress != "" {
+		sinks = append(sinks, newGraphiteSink(*graphiteAddress, *graphitePrefix))
+	}
+	if *statsdAddress != "" {
+		sink, err := newStatsdSink(*statsdAddress, *statsdPrefix, *dogStatsd, *statsdSampleRate, *seed)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	formats, err := parseReportFormats(*reports)
+	if err != nil {
+		return err
+	}
+	reportFormats = formats
+	if *htmlReport {
+		reportFormats["html"] = true
+	}
+
+	if reportPercentiles, err = parsePercentiles(*percentiles); err != nil {
+		return err
+	}
+
+	scenario, err := loadScenario(*scenarioPath)
+	if err != nil {
+		return err
+	}
+	if err := setValidators(scenario.Validators); err != nil {
+		return err
+	}
+	if err := setJourneys(scenario.journeys()); err != nil {
+		return err
+	}
+	if err := setUserModel(scenario.UserModel); err != nil {
+		return err
+	}
+
+	if err := openLogs(*logDir); err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	workerAddresses := parseWorkerAddresses(*workers)
+	if *recordSamples && len(workerAddresses) == 0 {
+		if err := openSamples(filepath.Join(*logDir, "Samples.log")); err != nil {
+			return err
+		}
+		defer closeSamples()
+	}
+
+	random = rand.New(rand.NewSource(*seed))
+
+	Init()
+
+	logStat.Printf("[MAIN] Testing %s with random seed %d", serverUrl, *seed)
+
+	reportMetadata = runMetadata{
+		Command:      "run",
+		TargetUrl:    serverUrl,
+		ScenarioFile: *scenarioPath,
+		Scenario:     scenario,
+		Seed:         *seed,
+		Workers:      workerAddresses,
+		StartTime:    time.Now(),
+	}
+
+	if len(workerAddresses) > 0 {
+		if err := runDistributedScenario(scenario, workerAddresses, *seed, *startDelay); err != nil {
+			return err
+		}
+	} else {
+		feed := startLiveFeed()
+		liveDashboard := startDashboard(*dashboardMode, feed)
+
+		var liveServer *http.Server
+		if *webAddress != "" {
+			if liveServer, err = startLiveServer(*webAddress, feed); err != nil {
+				feed.close()
+				return err
+			}
+		}
+
+		if *otlpEndpoint != "" {
+			startSpanExporter(*otlpEndpoint)
+		}
+		startMetricsSinks(sinks, *metricsInterval)
+		runScenario(scenario)
+		stopMetricsSinks()
+		stopSpanExporter()
+
+		feed.close()
+		liveDashboard.wait()
+		if liveServer != nil {
+			shutdownContext, cancel := context.WithTimeout(context.Background(), time.Second)
+			liveServer.Shutdown(shutdownContext)
+			cancel()
+		}
+	}
+
+	reportMetadata.EndTime = time.Now()
+
+	if err := closeSamples(); err != nil {
+		return err
+	}
+	return writeReports(*logDir)
+}
+
+// workerIncompatibleFlags returns the flags given to a distributed run that only work in a local one: the live
+// dashboards, the metrics sinks and the span exporter watch the requests of this process
+func workerIncompatibleFlags(flags *flag.FlagSet) []string {
+	var incompatibleFlags []string
+	flags.Visit(func(setFlag *flag.Flag) {
+		switch setFlag.Name {
+		case "dashboard":
+			if setFlag.Value.String() != dashboardOff {
+				incompatibleFlags = append(incompatibleFlags, "-"+setFlag.Name)
+			}
+		case "web", "influx", "graphite", "statsd", "otlp":
+			incompatibleFlags = append(incompatibleFlags, "-"+setFlag.Name)
+		}
+	})
+	return incompatibleFlags
+}
+
+func setServerUrl(rawUrl string) error {
+	parsedUrl, err := url.ParseRequestURI(rawUrl)
+	if err != nil || parsedUrl.Host == "" || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") {
+		return fmt.Errorf("invalid server URL %q: an absolute http or https URL is expected", rawUrl)
+	}
+
+	serverUrl = rawUrl
+	return nil
+}
+
+func parseReportFormats(value string) (map[string]bool, error) {
+	formats := make(map[string]bool)
+
+	for _, format := range strings.Split(value, ",") {
+		format = strings.TrimSpace(format)
+		if format == "" {
+			continue
+		}
+
+		supported := false
+		for _, supportedFormat := range supportedReportFormats {
+			if format == supportedFormat {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			sortedFormats := append([]string(nil), supportedReportFormats...)
+			sort.Strings(sortedFormats)
+			return nil, fmt.Errorf("unknown report format %q, supported formats: %s",
+				format, strings.Join(sortedFormats, ", "))
+		}
+
+		formats[format] = true
+	}
+
+	if len(formats) == 0 {
+		return nil, errors.New("at least one report format is required")
+	}
+	return formats, nil
+}
+
+func openLogs(logDir string) error {
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return fmt.Errorf("unable to create log directory: %s", err)
+	}
+
+	outputs := []struct {
+		fileName string
+		logger   *log.Logger
+	}{
+		{"Info.log", logInfo},
+		{"Error.log", logError},
+		{"Stat.log", logStat},
+	}
+
+	for _, output := range outputs {
+		outfile, err := os.OpenFile(filepath.Join(logDir, output.fileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			closeLogs()
+			return fmt.Errorf("unable to open log file: %s", err)
+		}
+
+		logFiles = append(logFiles, outfile)
+		output.logger.SetOutput(outfile)
+	}
+
+	return nil
+}
+
+func closeLogs() {
+	for _, outfile := range logFiles {
+		outfile.Close()
+	}
+	logFiles = nil
+}
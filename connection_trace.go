@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connectionTimings splits a request into the phases of its connection. DNS, connect and TLS are zero
+// for a reused connection. Requests recorded before the timings were traced have traced unset.
+type connectionTimings struct {
+	traced       bool
+	reused       bool
+	dns          time.Duration
+	connect      time.Duration
+	tls          time.Duration
+	firstByte    time.Duration
+	bodyDownload time.Duration
+}
+
+// connectionTrace collects the httptrace events of one request. Dialing may go on in another goroutine
+// after the request has got a different connection, so the events are guarded by a mutex.
+type connectionTrace struct {
+	mux sync.Mutex
+
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	reused       bool
+}
+
+func (trace *connectionTrace) event(eventTime *time.Time, keepFirst bool) {
+	trace.mux.Lock()
+	defer trace.mux.Unlock()
+
+	if !keepFirst || eventTime.IsZero() {
+		*eventTime = time.Now()
+	}
+}
+
+func (trace *connectionTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { trace.event(&trace.dnsStart, true) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { trace.event(&trace.dnsDone, false) },
+		ConnectStart:      func(string, string) { trace.event(&trace.connectStart, true) },
+		ConnectDone:       func(string, string, error) { trace.event(&trace.connectDone, false) },
+		TLSHandshakeStart: func() { trace.event(&trace.tlsStart, true) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { trace.event(&trace.tlsDone, false) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			trace.mux.Lock()
+			trace.reused = info.Reused
+			trace.mux.Unlock()
+		},
+		GotFirstResponseByte: func() { trace.event(&trace.firstByte, true) },
+	}
+}
+
+func phaseDuration(start, done time.Time) time.Duration {
+	if start.IsZero() || done.Before(start) {
+		return 0
+	}
+	return done.Sub(start)
+}
+
+// timings returns the phases of a request sent at sendingStartTime whose body was read
+// from responseTime till bodyReadTime
+func (trace *connectionTrace) timings(sendingStartTime, responseTime, bodyReadTime time.Time) connectionTimings {
+	trace.mux.Lock()
+	defer trace.mux.Unlock()
+
+	timings := connectionTimings{
+		traced:       true,
+		reused:       trace.reused,
+		firstByte:    phaseDuration(sendingStartTime, trace.firstByte),
+		bodyDownload: phaseDuration(responseTime, bodyReadTime),
+	}
+	if !trace.reused {
+		timings.dns = phaseDuration(trace.dnsStart, trace.dnsDone)
+		timings.connect = phaseDuration(trace.connectStart, trace.connectDone)
+		timings.tls = phaseDuration(trace.tlsStart, trace.tlsDone)
+	}
+	return timings
+}
+
+// connectionStats keeps the distributions of the connection phases of an endpoint
+type connectionStats struct {
+	dns          *histogram
+	connect      *histogram
+	tls          *histogram
+	firstByte    *histogram
+	bodyDownload *histogram
+
+	newConnections    uint64
+	reusedConnections uint64
+}
+
+func newConnectionStats() *connectionStats {
+	return &connectionStats{
+		dns:          newHistogram(histogramSignificantDigits),
+		connect:      newHistogram(histogramSignificantDigits),
+		tls:          newHistogram(histogramSignificantDigits),
+		firstByte:    newHistogram(histogramSignificantDigits),
+		bodyDownload: newHistogram(histogramSignificantDigits),
+	}
+}
+
+func (stats *connectionStats) record(timings connectionTimings) {
+	if !timings.traced {
+		return
+	}
+
+	if timings.reused {
+		atomic.AddUint64(&stats.reusedConnections, 1)
+	} else {
+		atomic.AddUint64(&stats.newConnections, 1)
+	}
+
+	for _, phase := range []struct {
+		responseTime *histogram
+		duration     time.Duration
+	}{
+		{stats.dns, timings.dns},
+		{stats.connect, timings.connect},
+		{stats.tls, timings.tls},
+		{stats.firstByte, timings.firstByte},
+		{stats.bodyDownload, timings.bodyDownload},
+	} {
+		if phase.duration > 0 {
+			phase.responseTime.record(phase.duration)
+		}
+	}
+}
+
+func (stats *connectionStats) merge(other *connectionStats) {
+	stats.dns.merge(other.dns)
+	stats.connect.merge(other.connect)
+	stats.tls.merge(other.tls)
+	stats.firstByte.merge(other.firstByte)
+	stats.bodyDownload.merge(other.bodyDownload)
+
+	atomic.AddUint64(&stats.newConnections, atomic.LoadUint64(&other.newConnections))
+	atomic.AddUint64(&stats.reusedConnections, atomic.LoadUint64(&other.reusedConnections))
+}
+
+type connectionPhase struct {
+	name         string
+	responseTime *histogram
+}
+
+func (stats *connectionStats) phases() []connectionPhase {
+	return []connectionPhase{
+		{"DNS lookup", stats.dns},
+		{"TCP connect", stats.connect},
+		{"TLS handshake", stats.tls},
+		{"Time to first byte", stats.firstByte},
+		{"Body download", stats.bodyDownload},
+	}
+}
+
+func showConnectionStat(stats *connectionStats) {
+	newConnections, reusedConnections := atomic.LoadUint64(&stats.newConnections), atomic.LoadUint64(&stats.reusedConnections)
+	if newConnections+reusedConnections == 0 {
+		return
+	}
+
+	logStat.Printf("Connections: %d requests opened a new connection, %d requests reused a connection",
+		newConnections, reusedConnections)
+	logStat.Print("Connection phase timings:")
+
+	header := "Phase	Requests	Average in ms"
+	for _, percentile := range reportPercentiles {
+		header += "	" + percentileName(percentile) + " percentile in ms"
+	}
+	logStat.Print(header + "	Max in ms")
+
+	for _, phase := range stats.phases() {
+		row := fmt.Sprintf("%s	%d	%f", phase.name, phase.responseTime.count(), milliseconds(phase.responseTime.mean()))
+		for _, percentile := range reportPercentiles {
+			row += fmt.Sprintf("	%f", milliseconds(phase.responseTime.valueAtPercentile(percentile)))
+		}
+		logStat.Printf("%s	%f", row, milliseconds(phase.responseTime.max()))
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+)
+
+// messageSchedule describes when a client message was supposed to be sent, so latency can be corrected
+// for coordinated omission: a stalled server must not hide the requests a client could not send meanwhile.
+//
+// Arrival-rate clients know their schedule exactly: an iteration that waited in the backlog is late by the
+// time between its intended time and the moment a virtual user picked it up. Every request of the iteration
+// is measured from its own send time moved back by that lateness, so the queueing delay is carried forward
+// without adding the time the earlier requests and think times of the iteration took.
+//
+// Closed-loop clients have no fixed schedule, they send a message a think time after the previous one has
+// finished. For them the mean think time is used as the expected interval the way HdrHistogram does: a
+// response slower than the interval is also recorded as the responses that would have been sent during
+// the stall.
+type messageSchedule struct {
+	lateness         time.Duration
+	expectedInterval time.Duration
+}
+
+func (responseTime ResponseTime) correctedElapsedTime() time.Duration {
+	return responseTime.timeWhileSendingRequest.Add(responseTime.elapsedTime).Sub(responseTime.intendedSendTime)
+}
+
+func showCorrectedResponseTimeStat(responseTime, correctedResponseTime *histogram) {
+	if responseTime.count() == 0 {
+		return
+	}
+
+	logStat.Print("Response time corrected for coordinated omission:")
+	logStat.Print("Statistic	Raw in ms	Corrected in ms")
+	logStat.Printf("Requests	%d	%d", responseTime.count(), correctedResponseTime.count())
+	logStat.Printf("Average	%f	%f", milliseconds(responseTime.mean()), milliseconds(correctedResponseTime.mean()))
+	for _, percentile := range reportPercentiles {
+		logStat.Printf("%s percentile	%f	%f", percentileName(percentile),
+			milliseconds(responseTime.valueAtPercentile(percentile)),
+			milliseconds(correctedResponseTime.valueAtPercentile(percentile)))
+	}
+	logStat.Printf("Max	%f	%f", milliseconds(responseTime.max()), milliseconds(correctedResponseTime.max()))
+}
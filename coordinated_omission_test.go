@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func startIdleTestShop(t *testing.T) {
+	if err := openLogs(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(closeLogs)
+
+	shop := &mockShop{latency: distribution{kind: distributionConstant, params: []time.Duration{5 * time.Millisecond}},
+		random: rand.New(rand.NewSource(1))}
+	server := httptest.NewServer(shop.serveMux())
+	t.Cleanup(server.Close)
+
+	Init()
+	serverUrl = server.URL
+	random = rand.New(rand.NewSource(1))
+	activeJourneys, activeUserModel = nil, nil
+}
+
+func checkCorrectedEqualsRaw(t *testing.T, resource string) {
+	endpoint := currentPhaseStats.endpoint(resource)
+	if endpoint.responseTime.count() == 0 {
+		t.Fatalf("%s received no responses", resource)
+	}
+	rawCounts, correctedCounts := endpoint.responseTime.snapshot().Counts, endpoint.correctedResponseTime.snapshot().Counts
+	if len(rawCounts) != len(correctedCounts) {
+		t.Fatalf("%s: corrected response time has %d buckets, the raw one has %d", resource,
+			len(correctedCounts), len(rawCounts))
+	}
+	for index, count := range rawCounts {
+		if correctedCounts[index] != count {
+			t.Errorf("%s: corrected max is %v, raw max is %v on an idle server", resource,
+				endpoint.correctedResponseTime.max(), endpoint.responseTime.max())
+			return
+		}
+	}
+}
+
+func TestArrivalRateIterationMeasuresEveryRequestFromItsOwnSendTime(t *testing.T) {
+	startIdleTestShop(t)
+
+	userName := "ticketbright"
+	queryParams, contentType, requestBody := makeRequestParams(userName)
+	intendedTime := time.Now()
+	schedule := arrivalRateIteration{intendedTime: intendedTime}.schedule(intendedTime)
+
+	sendClientMessage(userName, queryParams, contentType, requestBody, 0, 0, rand.New(rand.NewSource(1)), schedule)
+
+	if buyRequests := currentPhaseStats.endpoint("/buy").responseTime.count(); buyRequests < 2 {
+		t.Fatalf("the iteration bought %d items, expected several", buyRequests)
+	}
+	checkCorrectedEqualsRaw(t, "/")
+	checkCorrectedEqualsRaw(t, "/buy")
+}
+
+func TestLateArrivalRateIterationCarriesItsLateness(t *testing.T) {
+	intendedTime := time.Now()
+	iteration := arrivalRateIteration{intendedTime: intendedTime}
+
+	if lateness := iteration.schedule(intendedTime.Add(time.Second)).lateness; lateness != time.Second {
+		t.Errorf("an iteration picked up a second late has a lateness of %v", lateness)
+	}
+	if lateness := iteration.schedule(intendedTime.Add(-time.Second)).lateness; lateness != 0 {
+		t.Errorf("an iteration picked up early has a lateness of %v", lateness)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	dashboardAuto  = "auto"
+	dashboardTui   = "tui"
+	dashboardPlain = "plain"
+	dashboardOff   = "off"
+)
+
+// dashboard prints the live state of a run every second: redrawn in place on a terminal, or as one
+// line per second when the output is redirected
+type dashboard struct {
+	output   io.Writer
+	terminal bool
+	done     chan struct{}
+}
+
+func isTerminal(file *os.File) bool {
+	fileInfo, err := file.Stat()
+	return err == nil && fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+func parseDashboardMode(mode string) error {
+	switch mode {
+	case dashboardAuto, dashboardTui, dashboardPlain, dashboardOff:
+		return nil
+	}
+	return fmt.Errorf("unknown dashboard mode %q, supported modes: %s",
+		mode, strings.Join([]string{dashboardAuto, dashboardTui, dashboardPlain, dashboardOff}, ", "))
+}
+
+// startDashboard shows the snapshots of the feed until it is closed
+func startDashboard(mode string, feed *liveFeed) *dashboard {
+	liveDashboard := &dashboard{output: os.Stdout, done: make(chan struct{})}
+
+	switch mode {
+	case dashboardOff:
+		return nil
+	case dashboardAuto:
+		liveDashboard.terminal = isTerminal(os.Stdout)
+	case dashboardTui:
+		liveDashboard.terminal = true
+	}
+
+	go liveDashboard.run(feed.subscribe())
+	return liveDashboard
+}
+
+func (liveDashboard *dashboard) run(snapshots chan liveSnapshot) {
+	defer close(liveDashboard.done)
+
+	for snapshot := range snapshots {
+		liveDashboard.show(snapshot)
+	}
+}
+
+// wait returns once the dashboard has shown the last snapshot of its closed feed
+func (liveDashboard *dashboard) wait() {
+	if liveDashboard != nil {
+		<-liveDashboard.done
+	}
+}
+
+func (liveDashboard *dashboard) show(snapshot liveSnapshot) {
+	percentiles := make([]string, len(livePercentiles))
+	for index, percentile := range livePercentiles {
+		percentiles[index] = fmt.Sprintf("p%s %.3f ms", formatPercentiles([]float64{percentile}),
+			snapshot.Percentiles[percentileKey(percentile)])
+	}
+
+	if !liveDashboard.terminal {
+		fmt.Fprintf(liveDashboard.output, "LIVE: %s [%s] clients %d, in flight %d, %d rps, %s, errors: get items %d, buy items %d\n",
+			snapshot.Time.Format("15:04:05"), snapshot.Phase, snapshot.Clients, snapshot.InFlight, snapshot.RequestsPerSecond,
+			strings.Join(percentiles, ", "), snapshot.GetItemsErrors, snapshot.BuyItemsErrors)
+		return
+	}
+
+	screen := &strings.Builder{}
+	screen.WriteString("\033[H\033[2J")
+	fmt.Fprintf(screen, "Testing %s                %s\n\n", serverUrl, snapshot.Time.Format("15:04:05"))
+	fmt.Fprintf(screen, "  Phase                %s (%s)\n", snapshot.Phase, snapshot.PhaseElapsed.Truncate(time.Second))
+	fmt.Fprintf(screen, "  Virtual clients      %d\n", snapshot.Clients)
+	fmt.Fprintf(screen, "  In-flight requests   %d\n", snapshot.InFlight)
+	fmt.Fprintf(screen, "  Requests per second  %d\n", snapshot.RequestsPerSecond)
+	fmt.Fprintf(screen, "  Response time (%ds)  %s\n", liveWindowSeconds, strings.Join(percentiles, "  "))
+	fmt.Fprintf(screen, "  Get items errors     %d\n", snapshot.GetItemsErrors)
+	fmt.Fprintf(screen, "  Buy items errors     %d\n", snapshot.BuyItemsErrors)
+	io.WriteString(liveDashboard.output, screen.String())
+}
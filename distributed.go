@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/rpc"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// workerShare is the part of the load generated by this process: worker index of count workers
+type workerShare struct {
+	index int
+	count int
+}
+
+var localWorker = workerShare{index: 0, count: 1}
+
+// share splits total clients between the workers, giving the remainder to the first ones
+func (worker workerShare) share(total int) int {
+	share := total / worker.count
+	if worker.index < total%worker.count {
+		share++
+	}
+	return share
+}
+
+type WorkerSetup struct {
+	ServerUrl   string
+	Seed        int64
+	WorkerIndex int
+	WorkersNum  int
+	Validators  map[string][]ValidatorSpec
+	Journeys    []Journey
+	UserModel   *UserModel
+}
+
+type PhaseAssignment struct {
+	Phase     Phase
+	StartTime time.Time
+}
+
+// WorkerService is the RPC service a worker exposes to the coordinator. A worker serves one
+// coordinator at a time: Setup, then RunPhase for every phase of the scenario, then Finish.
+type WorkerService struct {
+	samplesPath string
+	setUp       bool
+}
+
+func (service *WorkerService) Setup(setup WorkerSetup, reply *bool) error {
+	if setup.WorkersNum <= 0 || setup.WorkerIndex < 0 || setup.WorkerIndex >= setup.WorkersNum {
+		return fmt.Errorf("invalid worker %d of %d", setup.WorkerIndex, setup.WorkersNum)
+	}
+	if err := setServerUrl(setup.ServerUrl); err != nil {
+		return err
+	}
+	if err := setValidators(setup.Validators); err != nil {
+		return err
+	}
+	if err := setJourneys(setup.Journeys); err != nil {
+		return err
+	}
+	if err := setUserModel(setup.UserModel); err != nil {
+		return err
+	}
+
+	service.finish()
+
+	if service.samplesPath != "" {
+		if err := openSamples(service.samplesPath); err != nil {
+			return err
+		}
+	}
+
+	localWorker = workerShare{index: setup.WorkerIndex, count: setup.WorkersNum}
+	random = rand.New(rand.NewSource(setup.Seed + int64(setup.WorkerIndex)))
+
+	Init()
+
+	muxPhaseStatistics.Lock()
+	phaseStatsHistory = nil
+	muxPhaseStatistics.Unlock()
+
+	logStat.Printf("[WORKER] Worker %d of %d is testing %s with random seed %d",
+		setup.WorkerIndex+1, setup.WorkersNum, serverUrl, setup.Seed+int64(setup.WorkerIndex))
+
+	service.setUp = true
+	*reply = true
+	return nil
+}
+
+func (service *WorkerService) RunPhase(assignment PhaseAssignment, reply *PhaseSnapshot) error {
+	if !service.setUp {
+		return errors.New("worker is not set up")
+	}
+
+	if waitTime := time.Until(assignment.StartTime); waitTime > 0 {
+		time.Sleep(waitTime)
+	} else {
+		logError.Printf("[WORKER] %s has been started %s late, check the clocks of the hosts",
+			assignment.Phase.Name, -waitTime)
+	}
+
+	runPhase(assignment.Phase)
+
+	*reply = currentPhaseStats.snapshot()
+	return nil
+}
+
+func (service *WorkerService) Finish(done bool, reply *bool) error {
+	service.finish()
+	*reply = true
+	return nil
+}
+
+func (service *WorkerService) finish() {
+	if !service.setUp {
+		return
+	}
+
+	if err := closeSamples(); err != nil {
+		logError.Printf("[WORKER] Unable to close samples file. Error: %s", err)
+	}
+	localWorker = workerShare{index: 0, count: 1}
+	service.setUp = false
+}
+
+func workerCommand(arguments []string) error {
+	flags := newFlagSet("worker", "")
+	listenAddress := flags.String("listen", ":7070", "address to wait for a coordinator on")
+	logDir := flags.String("logs", "./logs", "directory for Info.log, Error.log, Stat.log and Samples.log")
+	recordSamples := flags.Bool("samples", true, "record raw samples to Samples.log for analyze and compare")
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	if err := openLogs(*logDir); err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	// The coordinator prints the merged statistics
+	reportFormats = map[string]bool{}
+
+	service := &WorkerService{}
+	if *recordSamples {
+		service.samplesPath = filepath.Join(*logDir, "Samples.log")
+	}
+
+	server := rpc.NewServer()
+	if err := server.Register(service); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", *listenAddress)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	logStat.Printf("[WORKER] Waiting for a coordinator on %s", listener.Addr())
+
+	for {
+		connection, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		logStat.Printf("[WORKER] Coordinator %s has been connected", connection.RemoteAddr())
+		server.ServeConn(connection)
+		service.finish()
+		logStat.Printf("[WORKER] Coordinator %s has been disconnected", connection.RemoteAddr())
+	}
+}
+
+func parseWorkerAddresses(value string) []string {
+	var addresses []string
+	for _, address := range strings.Split(value, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// runDistributedScenario runs every phase on all workers at once and merges their statistics.
+// Workers start a phase at the same wall clock time, so the clocks of their hosts must be synchronized.
+func runDistributedScenario(scenario *Scenario, workerAddresses []string, seed int64, startDelay time.Duration) error {
+	for _, phase := range scenario.Phases {
+		if phase.Executor == executorArrivalRate && phase.MaxInFlight < len(workerAddresses) {
+			return fmt.Errorf("phase %q: maxInFlight must not be less than the number of workers", phase.Name)
+		}
+	}
+
+	logStat.Printf("[MAIN] Splitting the load between workers %s, they record the raw samples",
+		strings.Join(workerAddresses, ", "))
+
+	workers := make([]*rpc.Client, len(workerAddresses))
+	for index, address := range workerAddresses {
+		worker, err := rpc.Dial("tcp", address)
+		if err != nil {
+			return fmt.Errorf("unable to connect to worker %s: %s", address, err)
+		}
+		defer worker.Close()
+		workers[index] = worker
+
+		setup := WorkerSetup{ServerUrl: serverUrl, Seed: seed, WorkerIndex: index, WorkersNum: len(workerAddresses),
+			Validators: scenario.Validators, Journeys: scenario.journeys(), UserModel: scenario.UserModel}
+		var reply bool
+		if err := worker.Call("WorkerService.Setup", setup, &reply); err != nil {
+			return fmt.Errorf("unable to set up worker %s: %s", address, err)
+		}
+	}
+
+	for _, phase := range scenario.Phases {
+		if _, err := runDistributedPhase(phase, workers, workerAddresses, startDelay); err != nil {
+			return err
+		}
+	}
+
+	for index, worker := range workers {
+		var reply bool
+		if err := worker.Call("WorkerService.Finish", true, &reply); err != nil {
+			logError.Printf("[MAIN] Unable to finish worker %s. Error: %s", workerAddresses[index], err)
+		}
+	}
+
+	return nil
+}
+
+// runDistributedPhase runs the phase on the workers and merges their snapshots into the current phase statistics,
+// it returns the snapshots of the workers
+func runDistributedPhase(phase Phase, workers []*rpc.Client, workerAddresses []string,
+	startDelay time.Duration) ([]PhaseSnapshot, error) {
+
+	phaseStartTime := time.Now().Add(startDelay)
+	assignment := PhaseAssignment{Phase: phase, StartTime: phaseStartTime}
+
+	snapshots := make([]PhaseSnapshot, len(workers))
+	calls := make([]*rpc.Call, len(workers))
+	for index, worker := range workers {
+		calls[index] = worker.Go("WorkerService.RunPhase", assignment, &snapshots[index], nil)
+	}
+
+	stats := startPhaseStats(phase.Name, phaseStartTime)
+	logStat.Printf("[MAIN] %s has been started on %d workers", phase.Name, len(workers))
+
+	for index, call := range calls {
+		<-call.Done
+		if call.Error != nil {
+			return nil, fmt.Errorf("worker %s failed to run %q: %s", workerAddresses[index], phase.Name, call.Error)
+		}
+		stats.merge(snapshots[index].phaseStats())
+	}
+
+	finishPhase(phase)
+	return snapshots, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary runs itself as the workers, so every worker has its own global state like a real worker host
+const (
+	testWorkerListenEnv = "LOAD_GENERATOR_TEST_WORKER_LISTEN"
+	testWorkerLogsEnv   = "LOAD_GENERATOR_TEST_WORKER_LOGS"
+)
+
+func TestMain(m *testing.M) {
+	if listenAddress := os.Getenv(testWorkerListenEnv); listenAddress != "" {
+		err := workerCommand([]string{"-listen", listenAddress, "-logs", os.Getenv(testWorkerLogsEnv), "-samples=false"})
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func freeLoopbackAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func startTestWorker(t *testing.T) *rpc.Client {
+	address := freeLoopbackAddress(t)
+
+	command := exec.Command(os.Args[0], "-test.run=^$")
+	command.Env = append(os.Environ(), testWorkerListenEnv+"="+address, testWorkerLogsEnv+"="+t.TempDir())
+	if err := command.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		command.Process.Kill()
+		command.Wait()
+	})
+
+	for attempt := 0; ; attempt++ {
+		worker, err := rpc.Dial("tcp", address)
+		if err == nil {
+			t.Cleanup(func() { worker.Close() })
+			return worker
+		}
+		if attempt == 100 {
+			t.Fatalf("worker on %s did not start: %s", address, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func histogramSnapshotCounts(snapshot HistogramSnapshot) map[int]uint64 {
+	counts := make(map[int]uint64)
+	for position, index := range snapshot.Indexes {
+		counts[index] += snapshot.Counts[position]
+	}
+	return counts
+}
+
+func checkMergedHistogram(t *testing.T, name string, merged *histogram, workers []HistogramSnapshot) {
+	expectedCounts := make(map[int]uint64)
+	var expectedTotal uint64
+	for _, worker := range workers {
+		for index, count := range histogramSnapshotCounts(worker) {
+			expectedCounts[index] += count
+			expectedTotal += count
+		}
+	}
+
+	if merged.count() != expectedTotal {
+		t.Errorf("%s: merged histogram has %d values, the workers have %d", name, merged.count(), expectedTotal)
+	}
+
+	mergedCounts := histogramSnapshotCounts(merged.snapshot())
+	if len(mergedCounts) != len(expectedCounts) {
+		t.Errorf("%s: merged histogram has %d buckets, the workers have %d", name, len(mergedCounts), len(expectedCounts))
+	}
+	for index, count := range expectedCounts {
+		if mergedCounts[index] != count {
+			t.Errorf("%s: bucket %d has %d values, the workers have %d", name, index, mergedCounts[index], count)
+		}
+	}
+}
+
+func TestDistributedPhaseMergesWorkerSnapshots(t *testing.T) {
+	if err := openLogs(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer closeLogs()
+
+	shop := &mockShop{latency: distribution{kind: distributionConstant, params: []time.Duration{time.Millisecond}},
+		errorRate: 0.1, random: rand.New(rand.NewSource(1))}
+	server := httptest.NewServer(shop.serveMux())
+	defer server.Close()
+
+	workers := []*rpc.Client{startTestWorker(t), startTestWorker(t)}
+	workerAddresses := []string{"worker 1", "worker 2"}
+	for index, worker := range workers {
+		setup := WorkerSetup{ServerUrl: server.URL, Seed: 1, WorkerIndex: index, WorkersNum: len(workers)}
+		var reply bool
+		if err := worker.Call("WorkerService.Setup", setup, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	phase := Phase{Name: "Two workers", Clients: 4, MessagesPerClient: 3, SendDelay: Duration(time.Millisecond)}
+	snapshots, err := runDistributedPhase(phase, workers, workerAddresses, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := currentPhaseStats
+
+	var sentRequests uint32
+	for index, snapshot := range snapshots {
+		if snapshot.SentRequests == 0 {
+			t.Errorf("worker %d sent no requests", index+1)
+		}
+		sentRequests += snapshot.SentRequests
+	}
+	if merged.sentRequestsCount != sentRequests {
+		t.Errorf("merged phase sent %d requests, the workers sent %d", merged.sentRequestsCount, sentRequests)
+	}
+
+	for _, endpoint := range testedEndpoints {
+		var responseTimes, correctedResponseTimes []HistogramSnapshot
+		var errorsCount int
+		var bytesReceived uint64
+		levels := make(map[int][]HistogramSnapshot)
+		for _, snapshot := range snapshots {
+			endpointSnapshot := snapshot.Endpoints[endpoint]
+			responseTimes = append(responseTimes, endpointSnapshot.ResponseTime)
+			correctedResponseTimes = append(correctedResponseTimes, endpointSnapshot.CorrectedResponseTime)
+			errorsCount += endpointSnapshot.endpointStats().errorsCount()
+			bytesReceived += endpointSnapshot.BytesReceived
+			for clientsNum, level := range endpointSnapshot.ClientsNumResponseTime {
+				levels[clientsNum] = append(levels[clientsNum], level)
+			}
+		}
+
+		mergedEndpoint := merged.endpoints[endpoint]
+		checkMergedHistogram(t, endpoint+" response time", mergedEndpoint.responseTime, responseTimes)
+		checkMergedHistogram(t, endpoint+" corrected response time", mergedEndpoint.correctedResponseTime,
+			correctedResponseTimes)
+		for clientsNum, level := range levels {
+			checkMergedHistogram(t, endpoint+" response time at a number of clients",
+				mergedEndpoint.clientsNumResponseTime.get(clientsNum), level)
+		}
+
+		if mergedErrorsCount := mergedEndpoint.errorsCount(); mergedErrorsCount != errorsCount {
+			t.Errorf("%s: merged phase has %d errors, the workers have %d", endpoint, mergedErrorsCount, errorsCount)
+		}
+		if mergedEndpoint.bytesReceived != bytesReceived {
+			t.Errorf("%s: merged phase received %d bytes, the workers received %d",
+				endpoint, mergedEndpoint.bytesReceived, bytesReceived)
+		}
+	}
+
+	if merged.endpoints["/"].responseTime.count()+uint64(merged.endpoints["/"].errorsCount()) == 0 {
+		t.Error("no get items requests were recorded")
+	}
+}
+
+func TestRunRejectsLocalOnlyFlagsWithWorkers(t *testing.T) {
+	tests := []struct {
+		arguments []string
+		error     string
+	}{
+		{arguments: []string{"-dashboard", "plain"}, error: "-dashboard cannot be used with -workers"},
+		{arguments: []string{"-web", ":8081", "-statsd", "localhost:8125"}, error: "-statsd, -web cannot be used with -workers"},
+		{arguments: []string{"-influx", "udp://localhost:8089", "-graphite", "localhost:2003", "-otlp", "http://localhost:4318"},
+			error: "-graphite, -influx, -otlp cannot be used with -workers"},
+	}
+
+	for _, test := range tests {
+		err := runCommand(append([]string{"-workers", "127.0.0.1:1"}, test.arguments...))
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%v: error is %v, expected %q", test.arguments, err, test.error)
+		}
+	}
+
+	err := runCommand([]string{"-workers", "127.0.0.1:1", "-dashboard", "off", "-logs", t.TempDir(), "-samples=false"})
+	if err == nil || strings.Contains(err.Error(), "cannot be used with -workers") {
+		t.Errorf("-dashboard off with -workers: error is %v, expected the unreachable worker", err)
+	}
+}
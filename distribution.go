@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	distributionConstant    = "constant"
+	distributionUniform     = "uniform"
+	distributionNormal      = "normal"
+	distributionExponential = "exponential"
+	distributionLogNormal   = "lognormal"
+	distributionEmpirical   = "empirical"
+)
+
+// distribution describes a random delay, written as "kind:param,param", e.g. "uniform:5ms,20ms".
+// A bare duration such as "10ms" is a constant delay. A log-normal distribution is given by its mean
+// and standard deviation, "lognormal:700ms,300ms".
+//
+// An empirical distribution is sampled from a histogram file, "empirical:think-times.csv", whose lines
+// are a duration and its count, such as "500ms,12". A relative path is taken from the directory of the
+// scenario file, or from the working directory for a distribution given on the command line, so the
+// histogram is only read by loadHistogram once the directory is known. Lines starting with # are comments.
+type distribution struct {
+	kind   string
+	params []time.Duration
+
+	path             string
+	values           []time.Duration
+	cumulativeCounts []float64
+}
+
+var distributionParamsNum = map[string]int{
+	distributionConstant:    1,
+	distributionUniform:     2,
+	distributionNormal:      2,
+	distributionExponential: 1,
+	distributionLogNormal:   2,
+}
+
+func parseDistribution(value string) (distribution, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return distribution{kind: distributionConstant, params: []time.Duration{0}}, nil
+	}
+
+	kind, rawParams := distributionConstant, value
+	if separatorIndex := strings.Index(value, ":"); separatorIndex >= 0 {
+		kind, rawParams = strings.TrimSpace(value[:separatorIndex]), value[separatorIndex+1:]
+	}
+
+	if kind == distributionEmpirical {
+		path := strings.TrimSpace(rawParams)
+		if path == "" {
+			return distribution{}, errors.New("empirical distribution expects a histogram file")
+		}
+		return distribution{kind: distributionEmpirical, path: path}, nil
+	}
+
+	paramsNum, ok := distributionParamsNum[kind]
+	if !ok {
+		return distribution{}, fmt.Errorf("unknown distribution %q in %q", kind, value)
+	}
+
+	parsed := distribution{kind: kind}
+	for _, rawParam := range strings.Split(rawParams, ",") {
+		param, err := time.ParseDuration(strings.TrimSpace(rawParam))
+		if err != nil {
+			return distribution{}, fmt.Errorf("invalid distribution %q: %s", value, err)
+		}
+		if param < 0 {
+			return distribution{}, fmt.Errorf("invalid distribution %q: negative duration %s", value, param)
+		}
+		parsed.params = append(parsed.params, param)
+	}
+
+	if len(parsed.params) != paramsNum {
+		return distribution{}, fmt.Errorf("%s distribution expects %d durations, got %q", kind, paramsNum, value)
+	}
+	if kind == distributionUniform && parsed.params[0] > parsed.params[1] {
+		return distribution{}, fmt.Errorf("invalid distribution %q: minimum is greater than maximum", value)
+	}
+	if kind == distributionLogNormal && parsed.params[0] == 0 {
+		return distribution{}, fmt.Errorf("invalid distribution %q: mean must be positive", value)
+	}
+
+	return parsed, nil
+}
+
+// loadHistogram reads the histogram of an empirical distribution, a relative path is taken from baseDirectory.
+// The other distributions have nothing to load.
+func (delay *distribution) loadHistogram(baseDirectory string) error {
+	if delay == nil || delay.kind != distributionEmpirical || len(delay.values) > 0 {
+		return nil
+	}
+
+	path := delay.path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDirectory, path)
+	}
+
+	loaded, err := loadEmpiricalDistribution(path)
+	if err != nil {
+		return err
+	}
+	delay.values, delay.cumulativeCounts = loaded.values, loaded.cumulativeCounts
+	return nil
+}
+
+func loadEmpiricalDistribution(path string) (distribution, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return distribution{}, fmt.Errorf("unable to read the histogram of an empirical distribution: %s", err)
+	}
+
+	parsed := distribution{kind: distributionEmpirical, path: path}
+	var totalCount float64
+	for lineIndex, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(char rune) bool { return char == ',' || char == ' ' || char == '\t' })
+		if len(fields) == 0 || len(fields) > 2 {
+			return distribution{}, fmt.Errorf("%s:%d: expected a duration and a count", path, lineIndex+1)
+		}
+
+		value, err := time.ParseDuration(fields[0])
+		if err != nil || value < 0 {
+			return distribution{}, fmt.Errorf("%s:%d: invalid duration %q", path, lineIndex+1, fields[0])
+		}
+		count := 1.0
+		if len(fields) == 2 {
+			if count, err = strconv.ParseFloat(fields[1], 64); err != nil || count < 0 {
+				return distribution{}, fmt.Errorf("%s:%d: invalid count %q", path, lineIndex+1, fields[1])
+			}
+		}
+		if count == 0 {
+			continue
+		}
+
+		totalCount += count
+		parsed.values = append(parsed.values, value)
+		parsed.cumulativeCounts = append(parsed.cumulativeCounts, totalCount)
+	}
+
+	if len(parsed.values) == 0 {
+		return distribution{}, fmt.Errorf("%s: the histogram is empty", path)
+	}
+	return parsed, nil
+}
+
+func (delay distribution) String() string {
+	if delay.kind == distributionEmpirical {
+		return delay.kind + ":" + delay.path
+	}
+
+	params := make([]string, len(delay.params))
+	for index, param := range delay.params {
+		params[index] = param.String()
+	}
+	return delay.kind + ":" + strings.Join(params, ",")
+}
+
+func (delay distribution) MarshalJSON() ([]byte, error) {
+	return json.Marshal(delay.String())
+}
+
+func (delay *distribution) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("distribution must be a string such as \"uniform:5ms,20ms\": %s", err)
+	}
+
+	parsed, err := parseDistribution(value)
+	if err != nil {
+		return err
+	}
+	*delay = parsed
+	return nil
+}
+
+type distributionGob struct {
+	Kind             string
+	Params           []time.Duration
+	Path             string
+	Values           []time.Duration
+	CumulativeCounts []float64
+}
+
+// GobEncode and GobDecode let the distributions of a scenario travel to the workers of a distributed run,
+// empirical ones with their histogram, so the workers do not need the histogram file
+func (delay distribution) GobEncode() ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(distributionGob{Kind: delay.kind, Params: delay.params, Path: delay.path,
+		Values: delay.values, CumulativeCounts: delay.cumulativeCounts})
+	return buffer.Bytes(), err
+}
+
+func (delay *distribution) GobDecode(data []byte) error {
+	var decoded distributionGob
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&decoded); err != nil {
+		return err
+	}
+	*delay = distribution{kind: decoded.Kind, params: decoded.Params, path: decoded.Path, values: decoded.Values,
+		cumulativeCounts: decoded.CumulativeCounts}
+	return nil
+}
+
+// mean is the average delay, the expected interval of the closed-loop clients that wait for it
+func (delay distribution) mean() time.Duration {
+	switch delay.kind {
+	case distributionUniform:
+		return (delay.params[0] + delay.params[1]) / 2
+	case distributionNormal, distributionExponential, distributionLogNormal, distributionConstant:
+		return delay.params[0]
+	case distributionEmpirical:
+		var sum, previousCount float64
+		for index, value := range delay.values {
+			sum += float64(value) * (delay.cumulativeCounts[index] - previousCount)
+			previousCount = delay.cumulativeCounts[index]
+		}
+		return time.Duration(sum / previousCount)
+	default:
+		return 0
+	}
+}
+
+func (delay distribution) sample(random *rand.Rand) time.Duration {
+	switch delay.kind {
+	case distributionUniform:
+		minDelay, maxDelay := delay.params[0], delay.params[1]
+		return minDelay + time.Duration(random.Int63n(int64(maxDelay-minDelay)+1))
+	case distributionNormal:
+		mean, stdDev := delay.params[0], delay.params[1]
+		if sampled := time.Duration(float64(mean) + random.NormFloat64()*float64(stdDev)); sampled > 0 {
+			return sampled
+		}
+		return 0
+	case distributionExponential:
+		return time.Duration(random.ExpFloat64() * float64(delay.params[0]))
+	case distributionLogNormal:
+		mean, stdDev := float64(delay.params[0]), float64(delay.params[1])
+		sigmaSquared := math.Log(1 + stdDev*stdDev/(mean*mean))
+		mu := math.Log(mean) - sigmaSquared/2
+		return time.Duration(math.Exp(mu + random.NormFloat64()*math.Sqrt(sigmaSquared)))
+	case distributionEmpirical:
+		point := random.Float64() * delay.cumulativeCounts[len(delay.cumulativeCounts)-1]
+		index := sort.SearchFloat64s(delay.cumulativeCounts, point)
+		if index >= len(delay.values) {
+			index = len(delay.values) - 1
+		}
+		return delay.values[index]
+	case distributionConstant:
+		return delay.params[0]
+	default:
+		return 0
+	}
+}
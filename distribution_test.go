@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadScenarioReadsHistogramsFromScenarioDirectory(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.Mkdir(filepath.Join(directory, "histograms"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	histogram := []byte("# think times\n300ms,1\n")
+	if err := ioutil.WriteFile(filepath.Join(directory, "histograms", "think-times.csv"), histogram, 0644); err != nil {
+		t.Fatal(err)
+	}
+	scenarioPath := filepath.Join(directory, "scenario.json")
+	scenario := `{"phases": [{"name": "Browse", "clients": 1, "messagesPerClient": 1,
+		"thinkTime": "empirical:histograms/think-times.csv"}],
+		"journey": {"name": "browse", "steps": [{"endpoint": "/", "thinkTime": "empirical:histograms/think-times.csv"},
+			{"endpoint": "/"}]}}`
+	if err := ioutil.WriteFile(scenarioPath, []byte(scenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadScenario(scenarioPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, thinkTime := range map[string]*distribution{"phase": loaded.Phases[0].ThinkTime,
+		"journey step": loaded.Journey.Steps[0].ThinkTime} {
+		if thinkTime == nil || thinkTime.mean() != 300*time.Millisecond {
+			t.Fatalf("%s think time is %v, expected the 300ms of the histogram", name, thinkTime)
+		}
+		if path := thinkTime.String(); path != "empirical:histograms/think-times.csv" {
+			t.Errorf("%s think time is written as %s, expected the path of the scenario file", name, path)
+		}
+	}
+
+	userModelScenario := `{"phases": [{"name": "Browse", "clients": 1, "messagesPerClient": 1}],
+		"userModel": {"states": [{"name": "browse", "steps": [{"endpoint": "/"}],
+			"thinkTime": "empirical:histograms/think-times.csv", "transitions": {"leave": 1}}, {"name": "leave"}]}}`
+	if err := ioutil.WriteFile(scenarioPath, []byte(userModelScenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = loadScenario(scenarioPath); err != nil {
+		t.Fatal(err)
+	}
+	if thinkTime := loaded.UserModel.States[0].ThinkTime; thinkTime == nil || thinkTime.mean() != 300*time.Millisecond {
+		t.Errorf("user model state think time is %v, expected the 300ms of the histogram", thinkTime)
+	}
+
+	thinkTime, err := parseDistribution("empirical:histograms/think-times.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := thinkTime.loadHistogram(""); err == nil {
+		t.Error("the histogram was read although the working directory has none")
+	}
+	if err := thinkTime.loadHistogram(directory); err != nil || thinkTime.mean() != 300*time.Millisecond {
+		t.Errorf("the histogram relative to %s is not loaded: %v", directory, err)
+	}
+}
+
+func TestLoadEmpiricalDistributionReportsInvalidLines(t *testing.T) {
+	tests := []struct {
+		histogram string
+		error     string
+	}{
+		{histogram: "100ms,1\n,\n", error: ":2: expected a duration and a count"},
+		{histogram: " \t\n100ms,1\n , \t\n", error: ":3: expected a duration and a count"},
+		{histogram: "100ms,1,2\n", error: ":1: expected a duration and a count"},
+		{histogram: "fast,1\n", error: `:1: invalid duration "fast"`},
+		{histogram: "100ms,-1\n", error: `:1: invalid count "-1"`},
+		{histogram: "# nothing\n100ms,0\n", error: "the histogram is empty"},
+	}
+
+	path := filepath.Join(t.TempDir(), "think-times.csv")
+	for _, test := range tests {
+		if err := ioutil.WriteFile(path, []byte(test.histogram), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadEmpiricalDistribution(path)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%q: error is %v, expected %q", test.histogram, err, test.error)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Errors are classified so that a report tells a server that refuses connections from one that answers
+// with a wrong body. A failed request is classified by its transport error, a received response by its
+// status code (http_503 and so on) and body.
+const (
+	errorClassTimeout           = "timeout"
+	errorClassConnectionRefused = "connection_refused"
+	errorClassConnectionReset   = "connection_reset"
+	errorClassDns               = "dns"
+	errorClassTls               = "tls"
+	errorClassTransport         = "transport"
+	errorClassBodyMismatch      = "body_mismatch"
+	errorClassJsonParse         = "json_parse"
+
+	errorClassExamplesNum = 3
+)
+
+func statusErrorClass(statusCode int) string {
+	return "http_" + strconv.Itoa(statusCode)
+}
+
+func classifyTransportError(err error) string {
+	var dnsError *net.DNSError
+	var netError net.Error
+	var recordHeaderError tls.RecordHeaderError
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var certificateInvalidError x509.CertificateInvalidError
+	var hostnameError x509.HostnameError
+
+	switch {
+	case errors.As(err, &dnsError):
+		return errorClassDns
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netError) && netError.Timeout():
+		return errorClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errorClassConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errorClassConnectionReset
+	case errors.As(err, &recordHeaderError), errors.As(err, &unknownAuthorityError),
+		errors.As(err, &certificateInvalidError), errors.As(err, &hostnameError),
+		strings.Contains(err.Error(), "tls: "):
+		return errorClassTls
+	}
+	return errorClassTransport
+}
+
+// classifyErrorMessage recovers the class of an error recorded by a run that did not classify errors
+func classifyErrorMessage(message string) string {
+	switch {
+	case strings.HasPrefix(message, "wrong status code: "):
+		if statusCode, err := strconv.Atoi(strings.TrimPrefix(message, "wrong status code: ")); err == nil {
+			return statusErrorClass(statusCode)
+		}
+	case strings.HasPrefix(message, "wrong response body"):
+		return errorClassBodyMismatch
+	}
+	return errorClassTransport
+}
+
+type errorExample struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+type errorClassReport struct {
+	Class     string         `json:"class"`
+	Count     int            `json:"count"`
+	PerSecond []uint64       `json:"perSecond"`
+	Examples  []errorExample `json:"examples"`
+}
+
+// errorClassStats keeps the errors of one class in constant memory: their count, their count per second and
+// a reservoir of examples. Every error of the class has the same chance to be an example, so a phase that
+// fails in different ways over time shows each of them.
+type errorClassStats struct {
+	count     int
+	perSecond *timeSeries
+	examples  []errorExample
+}
+
+func newErrorClassStats(startTime time.Time) *errorClassStats {
+	return &errorClassStats{perSecond: newTimeSeries(startTime)}
+}
+
+func (class *errorClassStats) record(errResponse ErrResponse, random *rand.Rand) {
+	class.count++
+	class.perSecond.add(errResponse.time, 1)
+
+	example := errorExample{Time: errResponse.time, Message: errResponse.message}
+	if len(class.examples) < errorClassExamplesNum {
+		class.examples = append(class.examples, example)
+	} else if index := random.Intn(class.count); index < errorClassExamplesNum {
+		class.examples[index] = example
+	}
+}
+
+// merge keeps the examples of both reservoirs with a chance proportional to the number of errors
+// each of their examples stands for
+func (class *errorClassStats) merge(other *errorClassStats, random *rand.Rand) {
+	var examples []errorExample
+	ownExamples := append([]errorExample(nil), class.examples...)
+	otherExamples := append([]errorExample(nil), other.examples...)
+	for len(examples) < errorClassExamplesNum && len(ownExamples)+len(otherExamples) > 0 {
+		var ownWeight, otherWeight float64
+		if len(ownExamples) > 0 {
+			ownWeight = float64(class.count) / float64(len(class.examples)) * float64(len(ownExamples))
+		}
+		if len(otherExamples) > 0 {
+			otherWeight = float64(other.count) / float64(len(other.examples)) * float64(len(otherExamples))
+		}
+
+		pickedExamples := &ownExamples
+		if random.Float64()*(ownWeight+otherWeight) >= ownWeight {
+			pickedExamples = &otherExamples
+		}
+		index := random.Intn(len(*pickedExamples))
+		examples = append(examples, (*pickedExamples)[index])
+		*pickedExamples = append((*pickedExamples)[:index], (*pickedExamples)[index+1:]...)
+	}
+
+	class.count += other.count
+	class.perSecond.merge(other.perSecond)
+	class.examples = examples
+}
+
+func (class *errorClassStats) copy() *errorClassStats {
+	return &errorClassStats{count: class.count, perSecond: class.perSecond.snapshot().timeSeries(),
+		examples: append([]errorExample(nil), class.examples...)}
+}
+
+// errorClasses reports the errors of every class, most frequent first, with the examples in time order
+func (stats *endpointStats) errorClasses() []errorClassReport {
+	stats.muxErrors.Lock()
+	reports := make([]errorClassReport, 0, len(stats.errorClassesStats))
+	for name, class := range stats.errorClassesStats {
+		report := errorClassReport{Class: name, Count: class.count, PerSecond: class.perSecond.values(),
+			Examples: append([]errorExample(nil), class.examples...)}
+		sort.Slice(report.Examples, func(i, j int) bool { return report.Examples[i].Time.Before(report.Examples[j].Time) })
+		reports = append(reports, report)
+	}
+	stats.muxErrors.Unlock()
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Count != reports[j].Count {
+			return reports[i].Count > reports[j].Count
+		}
+		return reports[i].Class < reports[j].Class
+	})
+	return reports
+}
+
+func (stats *endpointStats) errorClassCounts() map[string]int {
+	stats.muxErrors.Lock()
+	defer stats.muxErrors.Unlock()
+
+	counts := make(map[string]int)
+	for name, class := range stats.errorClassesStats {
+		counts[name] = class.count
+	}
+	return counts
+}
+
+func showErrorClassesStat(stats *phaseStats) {
+	var classesNum int
+	for _, endpoint := range stats.endpointNames() {
+		classesNum += len(stats.endpoint(endpoint).errorClassCounts())
+	}
+	if classesNum == 0 {
+		return
+	}
+
+	logStat.Print("Error classification:")
+	logStat.Print("Endpoint	Class	Errors	Examples")
+	for _, endpoint := range stats.endpointNames() {
+		for _, class := range stats.endpoint(endpoint).errorClasses() {
+			examples := make([]string, len(class.Examples))
+			for index, example := range class.Examples {
+				examples[index] = example.Time.Format("15:04:05") + " " + example.Message
+			}
+			logStat.Printf("%s	%s	%d	%s", endpoint, class.Class, class.Count, strings.Join(examples, " | "))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestErrorClassesKeepBoundedExamples(t *testing.T) {
+	startTime := time.Unix(1700000000, 0)
+	stats := newEndpointStats(startTime)
+	for index := 0; index < 1000; index++ {
+		stats.recordError(ErrResponse{time: startTime.Add(time.Duration(index) * time.Millisecond),
+			class: statusErrorClass(503), message: "wrong status code: 503"})
+	}
+	for index := 0; index < 10; index++ {
+		stats.recordError(ErrResponse{time: startTime.Add(1500 * time.Millisecond), class: errorClassTimeout,
+			message: fmt.Sprintf("Get \"http://localhost/\": timeout %d", index)})
+	}
+
+	other := newEndpointStats(startTime)
+	other.recordError(ErrResponse{time: startTime.Add(2 * time.Second), class: errorClassTimeout, message: "timeout"})
+	stats.merge(other)
+
+	if count := stats.errorsCount(); count != 1011 {
+		t.Errorf("%d errors are counted, expected 1011", count)
+	}
+
+	classes := stats.errorClasses()
+	if len(classes) != 2 {
+		t.Fatalf("%d error classes are reported, expected 2", len(classes))
+	}
+
+	expected := []struct {
+		class     string
+		count     int
+		perSecond []uint64
+	}{
+		{statusErrorClass(503), 1000, []uint64{1000}},
+		{errorClassTimeout, 11, []uint64{0, 10, 1}},
+	}
+	for index, class := range classes {
+		if class.Class != expected[index].class || class.Count != expected[index].count {
+			t.Errorf("class %d is %s with %d errors, expected %s with %d", index, class.Class, class.Count,
+				expected[index].class, expected[index].count)
+		}
+		if fmt.Sprint(class.PerSecond) != fmt.Sprint(expected[index].perSecond) {
+			t.Errorf("%s: errors per second are %v, expected %v", class.Class, class.PerSecond, expected[index].perSecond)
+		}
+		if len(class.Examples) != errorClassExamplesNum {
+			t.Errorf("%s: %d examples are kept, expected %d", class.Class, len(class.Examples), errorClassExamplesNum)
+		}
+		for exampleIndex := 1; exampleIndex < len(class.Examples); exampleIndex++ {
+			if class.Examples[exampleIndex].Time.Before(class.Examples[exampleIndex-1].Time) {
+				t.Errorf("%s: examples are not in time order", class.Class)
+			}
+		}
+	}
+
+	if breakdown := stats.errorBreakdown[`Get "http://localhost/"`]; breakdown != 10 {
+		t.Errorf("%d timeouts are in the breakdown, expected 10", breakdown)
+	}
+}
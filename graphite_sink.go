@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var graphiteUnsafeCharacters = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// graphiteSink writes the aggregated series in the Graphite plaintext protocol over TCP, one metric
+// per line named prefix.phase.endpoint.encoding.status.field
+type graphiteSink struct {
+	aggregator metricsAggregator
+
+	address string
+	prefix  string
+	conn    net.Conn
+}
+
+func newGraphiteSink(address, prefix string) *graphiteSink {
+	return &graphiteSink{address: address, prefix: strings.Trim(prefix, ".")}
+}
+
+func (sink *graphiteSink) name() string {
+	return "Graphite " + sink.address
+}
+
+func (sink *graphiteSink) record(metric requestMetric) {
+	sink.aggregator.record(metric)
+}
+
+// graphiteNode turns a tag value into one node of a metric path, so "/" becomes "root" and "/buy" becomes "buy"
+func graphiteNode(value string) string {
+	node := strings.Trim(graphiteUnsafeCharacters.ReplaceAllString(value, "_"), "_")
+	if node == "" {
+		return "root"
+	}
+	return node
+}
+
+func (sink *graphiteSink) lines(series map[metricSeriesKey]*metricSeries, flushTime time.Time) []string {
+	var lines []string
+
+	for key, values := range series {
+		path := []string{graphiteNode(key.phase), graphiteNode(key.endpoint), graphiteNode(key.encoding), graphiteNode(key.status)}
+		if key.phase == "" {
+			path = path[1:]
+		}
+		if sink.prefix != "" {
+			path = append([]string{sink.prefix}, path...)
+		}
+
+		for _, field := range values.fields() {
+			lines = append(lines, fmt.Sprintf("%s.%s %s %d", strings.Join(path, "."), graphiteNode(field.name),
+				field.format(), flushTime.Unix()))
+		}
+	}
+
+	sort.Strings(lines)
+	return lines
+}
+
+func (sink *graphiteSink) flush(flushTime time.Time) error {
+	series := sink.aggregator.take()
+	if len(series) == 0 {
+		return nil
+	}
+
+	payload := &bytes.Buffer{}
+	for _, line := range sink.lines(series, flushTime) {
+		payload.WriteString(line)
+		payload.WriteByte('\n')
+	}
+
+	if sink.conn == nil {
+		conn, err := net.DialTimeout("tcp", sink.address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		sink.conn = conn
+	}
+
+	sink.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := sink.conn.Write(payload.Bytes()); err != nil {
+		sink.conn.Close()
+		sink.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (sink *graphiteSink) close() error {
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
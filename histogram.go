@@ -0,0 +1,236 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// histogram is a high dynamic range histogram of durations in microseconds. Values are grouped in
+// buckets whose width keeps the given number of significant decimal digits, so the memory use is fixed
+// no matter how many values are recorded. Recording is lock-free and may run concurrently with reads.
+type histogram struct {
+	significantDigits           int
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount          int64
+	subBucketMask               int64
+
+	counts     []uint64
+	totalCount uint64
+	totalSum   uint64
+	minValue   int64
+	maxValue   int64
+}
+
+const (
+	histogramHighestTrackableValue = int64(time.Hour / time.Microsecond)
+	histogramSignificantDigits     = 3
+
+	// Per-clients-number histograms are numerous, so they trade precision for memory
+	clientsNumHistogramSignificantDigits = 2
+)
+
+func newHistogram(significantDigits int) *histogram {
+	largestValueWithSingleUnitResolution := 2 * int64(math.Pow10(significantDigits))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(float64(largestValueWithSingleUnitResolution))))
+
+	subBucketCount := int64(1) << subBucketCountMagnitude
+
+	bucketsNeeded := 1
+	for smallestUntrackableValue := subBucketCount; smallestUntrackableValue <= histogramHighestTrackableValue; smallestUntrackableValue <<= 1 {
+		bucketsNeeded++
+	}
+
+	return &histogram{
+		significantDigits:           significantDigits,
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketHalfCount:          subBucketCount / 2,
+		subBucketMask:               subBucketCount - 1,
+		counts:                      make([]uint64, (bucketsNeeded+1)<<(subBucketCountMagnitude-1)),
+		minValue:                    math.MaxInt64,
+	}
+}
+
+func durationToHistogramValue(duration time.Duration) int64 {
+	value := int64(duration / time.Microsecond)
+	if value < 0 {
+		return 0
+	}
+	if value > histogramHighestTrackableValue {
+		return histogramHighestTrackableValue
+	}
+	return value
+}
+
+func histogramValueToDuration(value int64) time.Duration {
+	return time.Duration(value) * time.Microsecond
+}
+
+func (h *histogram) countsIndex(value int64) int {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(value|h.subBucketMask))
+	bucketIndex := pow2Ceiling - int(h.subBucketHalfCountMagnitude) - 1
+	subBucketIndex := value >> uint(bucketIndex)
+
+	return (bucketIndex+1)<<h.subBucketHalfCountMagnitude + int(subBucketIndex-h.subBucketHalfCount)
+}
+
+func (h *histogram) lowestEquivalentValue(index int) int64 {
+	lowestEquivalentValue, _ := h.equivalentValueRange(index)
+	return lowestEquivalentValue
+}
+
+func (h *histogram) highestEquivalentValue(index int) int64 {
+	lowestEquivalentValue, width := h.equivalentValueRange(index)
+	return lowestEquivalentValue + width - 1
+}
+
+// equivalentValueRange returns the lowest value counted at the index and the number of values counted there
+func (h *histogram) equivalentValueRange(index int) (int64, int64) {
+	bucketIndex := index>>h.subBucketHalfCountMagnitude - 1
+	subBucketIndex := int64(index)&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+	if bucketIndex < 0 {
+		subBucketIndex -= h.subBucketHalfCount
+		bucketIndex = 0
+	}
+
+	return subBucketIndex << uint(bucketIndex), int64(1) << uint(bucketIndex)
+}
+
+func (h *histogram) record(duration time.Duration) {
+	h.recordValues(durationToHistogramValue(duration), 1)
+}
+
+// recordWithExpectedInterval records a duration and, when it is longer than the expected interval
+// between two recordings, the durations of the recordings that were missed meanwhile.
+func (h *histogram) recordWithExpectedInterval(duration, expectedInterval time.Duration) {
+	h.record(duration)
+
+	if expectedInterval <= 0 {
+		return
+	}
+
+	for missedDuration := duration - expectedInterval; missedDuration >= expectedInterval; missedDuration -= expectedInterval {
+		h.record(missedDuration)
+	}
+}
+
+func (h *histogram) recordValues(value int64, count uint64) {
+	atomic.AddUint64(&h.counts[h.countsIndex(value)], count)
+	atomic.AddUint64(&h.totalCount, count)
+	atomic.AddUint64(&h.totalSum, uint64(value)*count)
+
+	h.updateMinMax(value, value)
+}
+
+func (h *histogram) updateMinMax(minValue, maxValue int64) {
+	for {
+		currentMin := atomic.LoadInt64(&h.minValue)
+		if minValue >= currentMin || atomic.CompareAndSwapInt64(&h.minValue, currentMin, minValue) {
+			break
+		}
+	}
+	for {
+		currentMax := atomic.LoadInt64(&h.maxValue)
+		if maxValue <= currentMax || atomic.CompareAndSwapInt64(&h.maxValue, currentMax, maxValue) {
+			break
+		}
+	}
+}
+
+func (h *histogram) merge(other *histogram) {
+	if other.count() == 0 {
+		return
+	}
+
+	if len(h.counts) != len(other.counts) {
+		for index := range other.counts {
+			if count := atomic.LoadUint64(&other.counts[index]); count > 0 {
+				h.recordValues(other.highestEquivalentValue(index), count)
+			}
+		}
+		return
+	}
+
+	for index := range other.counts {
+		if count := atomic.LoadUint64(&other.counts[index]); count > 0 {
+			atomic.AddUint64(&h.counts[index], count)
+		}
+	}
+	atomic.AddUint64(&h.totalCount, other.count())
+	atomic.AddUint64(&h.totalSum, atomic.LoadUint64(&other.totalSum))
+
+	h.updateMinMax(atomic.LoadInt64(&other.minValue), atomic.LoadInt64(&other.maxValue))
+}
+
+func (h *histogram) count() uint64 {
+	return atomic.LoadUint64(&h.totalCount)
+}
+
+func (h *histogram) min() time.Duration {
+	if h.count() == 0 {
+		return 0
+	}
+	return histogramValueToDuration(atomic.LoadInt64(&h.minValue))
+}
+
+func (h *histogram) max() time.Duration {
+	return histogramValueToDuration(atomic.LoadInt64(&h.maxValue))
+}
+
+func (h *histogram) mean() time.Duration {
+	totalCount := h.count()
+	if totalCount == 0 {
+		return 0
+	}
+	return time.Duration(float64(atomic.LoadUint64(&h.totalSum)) / float64(totalCount) * float64(time.Microsecond))
+}
+
+// valueAtPercentile returns the nearest-rank percentile: the smallest recorded value such that at least
+// percentile% of all recorded values are less than or equal to it. The 0th percentile is the minimum and
+// the 100th is the maximum. A value is reported as the highest value equivalent to its bucket, clamped
+// to the recorded maximum, so it is never less than the exact value and deviates from it by less than
+// the histogram precision. An empty histogram has all percentiles equal to zero.
+func (h *histogram) valueAtPercentile(percentile float64) time.Duration {
+	totalCount := h.count()
+	if totalCount == 0 {
+		return 0
+	}
+	if percentile <= 0 {
+		return h.min()
+	}
+	if percentile >= 100 {
+		return h.max()
+	}
+
+	rank := percentileRank(percentile, totalCount)
+
+	var cumulativeCount uint64
+	for index := range h.counts {
+		cumulativeCount += atomic.LoadUint64(&h.counts[index])
+		if cumulativeCount >= rank {
+			value := h.highestEquivalentValue(index)
+			if maxValue := atomic.LoadInt64(&h.maxValue); value > maxValue {
+				value = maxValue
+			}
+			return histogramValueToDuration(value)
+		}
+	}
+
+	return h.max()
+}
+
+// percentileRank returns ceil(percentile / 100 * count) limited to [1, count]. The percentile is
+// rounded to thousandths and the rank is computed on integers, so 95% of 100 values is exactly rank 95.
+func percentileRank(percentile float64, count uint64) uint64 {
+	percentileThousandths := uint64(math.Round(percentile * 1000))
+
+	rank := (percentileThousandths*count + 100*1000 - 1) / (100 * 1000)
+	if rank < 1 {
+		return 1
+	}
+	if rank > count {
+		return count
+	}
+	return rank
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValueAtPercentileNearestRank(t *testing.T) {
+	hundredValues := make([]time.Duration, 100)
+	for index := range hundredValues {
+		hundredValues[index] = time.Duration(index+1) * time.Microsecond
+	}
+
+	tests := []struct {
+		name     string
+		values   []time.Duration
+		expected map[float64]time.Duration
+	}{
+		{
+			name:   "one value",
+			values: []time.Duration{7 * time.Microsecond},
+			expected: map[float64]time.Duration{
+				0: 7 * time.Microsecond, 50: 7 * time.Microsecond, 95: 7 * time.Microsecond,
+				99.9: 7 * time.Microsecond, 100: 7 * time.Microsecond,
+			},
+		},
+		{
+			name:   "two values",
+			values: []time.Duration{9 * time.Microsecond, 3 * time.Microsecond},
+			expected: map[float64]time.Duration{
+				0: 3 * time.Microsecond, 50: 3 * time.Microsecond, 95: 9 * time.Microsecond,
+				99.9: 9 * time.Microsecond, 100: 9 * time.Microsecond,
+			},
+		},
+		{
+			name:   "hundred values",
+			values: hundredValues,
+			expected: map[float64]time.Duration{
+				0: 1 * time.Microsecond, 50: 50 * time.Microsecond, 95: 95 * time.Microsecond,
+				99.9: 100 * time.Microsecond, 100: 100 * time.Microsecond,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		h := newHistogram(histogramSignificantDigits)
+		for _, value := range test.values {
+			h.record(value)
+		}
+
+		for percentile, expected := range test.expected {
+			if actual := h.valueAtPercentile(percentile); actual != expected {
+				t.Errorf("%s: percentile %v is %s, expected %s", test.name, percentile, actual, expected)
+			}
+		}
+	}
+}
+
+func TestValueAtPercentileOfEmptyHistogram(t *testing.T) {
+	h := newHistogram(histogramSignificantDigits)
+	for _, percentile := range []float64{0, 50, 100} {
+		if actual := h.valueAtPercentile(percentile); actual != 0 {
+			t.Errorf("percentile %v of an empty histogram is %s, expected 0", percentile, actual)
+		}
+	}
+}
+
+func TestValueAtPercentileIsNeverLessThanExactValue(t *testing.T) {
+	h := newHistogram(histogramSignificantDigits)
+	exact := 123456 * time.Microsecond
+	h.record(exact)
+	h.record(2 * exact)
+
+	actual := h.valueAtPercentile(50)
+	if actual < exact || float64(actual-exact) > float64(exact)/1000 {
+		t.Errorf("median is %s, expected %s within the histogram precision", actual, exact)
+	}
+}
+
+func TestPercentileRank(t *testing.T) {
+	tests := []struct {
+		percentile float64
+		count      uint64
+		expected   uint64
+	}{
+		{0, 1, 1},
+		{50, 1, 1},
+		{100, 1, 1},
+		{50, 2, 1},
+		{95, 2, 2},
+		{95, 100, 95},
+		{99, 100, 99},
+		{99.9, 100, 100},
+		{99.9, 1000, 999},
+		{100, 100, 100},
+	}
+
+	for _, test := range tests {
+		if actual := percentileRank(test.percentile, test.count); actual != test.expected {
+			t.Errorf("rank of percentile %v of %d values is %d, expected %d",
+				test.percentile, test.count, actual, test.expected)
+		}
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []float64
+		invalid  bool
+	}{
+		{value: "50,90,99,99.9", expected: []float64{50, 90, 99, 99.9}},
+		{value: " 99 , 50,50 ", expected: []float64{50, 99}},
+		{value: "100", expected: []float64{100}},
+		{value: "0", invalid: true},
+		{value: "101", invalid: true},
+		{value: "p99", invalid: true},
+		{value: ",", invalid: true},
+	}
+
+	for _, test := range tests {
+		actual, err := parsePercentiles(test.value)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", test.value, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.value, err)
+			continue
+		}
+		if len(actual) != len(test.expected) {
+			t.Errorf("%q: got %v, expected %v", test.value, actual, test.expected)
+			continue
+		}
+		for index := range actual {
+			if actual[index] != test.expected[index] {
+				t.Errorf("%q: got %v, expected %v", test.value, actual, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestClientsNumHistogramsArePerLevel(t *testing.T) {
+	startTime := time.Now()
+	stats := newPhaseStats("test", startTime)
+
+	record := func(clientsNum int, elapsedTime time.Duration) {
+		stats.recordResponseTime("/", ResponseTime{clientsNum: clientsNum, elapsedTime: elapsedTime,
+			timeWhileSendingRequest: startTime, intendedSendTime: startTime})
+	}
+	for index := 0; index < 10; index++ {
+		record(10, 5*time.Microsecond)
+	}
+	for index := 0; index < 5; index++ {
+		record(20, 50*time.Microsecond)
+	}
+
+	levels := stats.endpoints["/"].clientsNumResponseTime
+	if clientsNums := levels.clientsNums(); len(clientsNums) != 2 || clientsNums[0] != 10 || clientsNums[1] != 20 {
+		t.Fatalf("levels are %v, expected [10 20]", clientsNums)
+	}
+
+	if count := levels.get(10).count(); count != 10 {
+		t.Errorf("10 clients level has %d requests, expected 10", count)
+	}
+	if count := levels.get(20).count(); count != 5 {
+		t.Errorf("20 clients level has %d requests, expected only its own 5", count)
+	}
+	if minValue := levels.get(20).min(); minValue != 50*time.Microsecond {
+		t.Errorf("20 clients level minimum is %s, expected 50µs: the levels must not be cumulative", minValue)
+	}
+	if maxValue := levels.get(10).max(); maxValue != 5*time.Microsecond {
+		t.Errorf("10 clients level maximum is %s, expected 5µs", maxValue)
+	}
+	if count := stats.endpoints["/"].responseTime.count(); count != 15 {
+		t.Errorf("endpoint has %d requests, expected 15", count)
+	}
+}
+
+func TestHistogramEquivalentValuesContainTheValue(t *testing.T) {
+	for _, significantDigits := range []int{clientsNumHistogramSignificantDigits, histogramSignificantDigits} {
+		h := newHistogram(significantDigits)
+		for _, value := range []int64{0, 1, 255, 256, 2000, 2003, 4000, 999999, 1000000, histogramHighestTrackableValue} {
+			index := h.countsIndex(value)
+			lowest, highest := h.lowestEquivalentValue(index), h.highestEquivalentValue(index)
+			if value < lowest || value > highest || h.countsIndex(lowest) != index || h.countsIndex(highest) != index {
+				t.Errorf("%d digits: %d is counted between %d and %d", significantDigits, value, lowest, highest)
+			}
+		}
+		if lowest := h.lowestEquivalentValue(h.countsIndex(2000)); lowest != 2000 {
+			t.Errorf("%d digits: 2ms is sent as %dµs", significantDigits, lowest)
+		}
+	}
+}
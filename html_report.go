@@ -0,0 +1,196 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type htmlPhase struct {
+	Report phaseReport
+	Charts []template.HTML
+}
+
+type htmlReport struct {
+	Metadata    runMetadata
+	Percentiles []string
+	Phases      []htmlPhase
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percentile": func(latency latencyReport, key string) float64 { return latency.Percentiles[key] },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Load test report</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin: 12px 0; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.chart { margin: 12px 0; }
+</style>
+</head>
+<body>
+<h1>Load test report</h1>
+<table>
+{{with .Metadata}}
+<tr><td>Command</td><td>{{.Command}}</td></tr>
+{{if .TargetUrl}}<tr><td>Target</td><td>{{.TargetUrl}}</td></tr>{{end}}
+{{if .SamplesFile}}<tr><td>Samples file</td><td>{{.SamplesFile}}</td></tr>{{end}}
+{{if .ScenarioFile}}<tr><td>Scenario file</td><td>{{.ScenarioFile}}</td></tr>{{end}}
+{{if .Seed}}<tr><td>Seed</td><td>{{.Seed}}</td></tr>{{end}}
+<tr><td>Started</td><td>{{.StartTime.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><td>Finished</td><td>{{.EndTime.Format "2006-01-02 15:04:05"}}</td></tr>
+{{if .Hostname}}<tr><td>Host</td><td>{{.Hostname}}</td></tr>{{end}}
+{{end}}
+</table>
+{{$percentiles := .Percentiles}}
+{{range .Phases}}
+<h2>{{.Report.Name}}</h2>
+<p>Sent requests: {{.Report.SentRequests}}, dropped iterations: {{.Report.DroppedIterations}}</p>
+<table>
+<tr><th>Endpoint</th><th>Responses</th><th>Errors</th><th>Average, ms</th>{{range $percentiles}}<th>{{.}}, ms</th>{{end}}<th>Max, ms</th><th>Corrected average, ms</th>{{range $percentiles}}<th>Corrected {{.}}, ms</th>{{end}}<th>Sent, MB/s</th><th>Received, MB/s</th></tr>
+{{range $endpoint := .Report.Endpoints}}
+<tr><td>{{.Endpoint}}</td><td>{{.Responses}}</td><td>{{.Errors}}</td><td>{{printf "%.3f" .Latency.MeanMs}}</td>{{range $percentiles}}<td>{{printf "%.3f" (percentile $endpoint.Latency .)}}</td>{{end}}<td>{{printf "%.3f" .Latency.MaxMs}}</td><td>{{printf "%.3f" .CorrectedLatency.MeanMs}}</td>{{range $percentiles}}<td>{{printf "%.3f" (percentile $endpoint.CorrectedLatency .)}}</td>{{end}}<td>{{printf "%.3f" .Transfer.SentMBPerSecond}}</td><td>{{printf "%.3f" .Transfer.ReceivedMBPerSecond}}</td></tr>
+{{end}}
+</table>
+{{range $endpoint := .Report.Endpoints}}{{if .ErrorClasses}}
+<table>
+<tr><th>Endpoint</th><th>Error class</th><th>Errors</th><th>Examples</th></tr>
+{{range .ErrorClasses}}<tr><td>{{$endpoint.Endpoint}}</td><td>{{.Class}}</td><td>{{.Count}}</td><td style="text-align: left">{{range .Examples}}{{.Time.Format "15:04:05"}} {{.Message}}<br>{{end}}</td></tr>
+{{end}}
+</table>
+{{end}}{{end}}
+{{if .Report.Journeys}}
+<table>
+<tr><th>Journey</th><th>Runs</th><th>Share, %</th><th>Completed</th><th>Failed</th><th>Average duration, ms</th>{{range $percentiles}}<th>{{.}}, ms</th>{{end}}<th>Max, ms</th></tr>
+{{range $journey := .Report.Journeys}}
+<tr><td>{{.Name}}</td><td>{{.Runs}}</td><td>{{printf "%.1f" .SharePercent}}</td><td>{{.Completed}}</td><td>{{.Failed}}</td><td>{{printf "%.3f" .Duration.MeanMs}}</td>{{range $percentiles}}<td>{{printf "%.3f" (percentile $journey.Duration .)}}</td>{{end}}<td>{{printf "%.3f" .Duration.MaxMs}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{if .Report.UserStates}}
+<table>
+<tr><th>State</th><th>Visits</th><th>Share of visits, %</th><th>Failed</th><th>Average latency, ms</th>{{range $percentiles}}<th>{{.}}, ms</th>{{end}}<th>Max, ms</th><th>Average dwell time, ms</th><th>Max dwell time, ms</th></tr>
+{{range $state := .Report.UserStates}}
+<tr><td>{{.Name}}</td><td>{{.Visits}}</td><td>{{printf "%.1f" .SharePercent}}</td><td>{{.Failed}}</td><td>{{printf "%.3f" .Latency.MeanMs}}</td>{{range $percentiles}}<td>{{printf "%.3f" (percentile $state.Latency .)}}</td>{{end}}<td>{{printf "%.3f" .Latency.MaxMs}}</td><td>{{printf "%.3f" .DwellTime.MeanMs}}</td><td>{{printf "%.3f" .DwellTime.MaxMs}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{range .Charts}}<div class="chart">{{.}}</div>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func writeHtmlReport(report *runReport, reportDir string) error {
+	data := htmlReport{Metadata: report.Metadata}
+	for _, percentile := range report.Metadata.Percentiles {
+		data.Percentiles = append(data.Percentiles, percentileKey(percentile))
+	}
+
+	for _, phase := range report.Phases {
+		if !phase.ShowStat {
+			continue
+		}
+
+		data.Phases = append(data.Phases, htmlPhase{Report: phase, Charts: []template.HTML{
+			throughputChart(phase).render(),
+			latencyClientsNumChart(phase, report.Metadata.Percentiles).render(),
+			errorRateChart(phase).render(),
+		}})
+	}
+
+	reportPath := filepath.Join(reportDir, "Report.html")
+	outfile, err := os.Create(reportPath)
+	if err != nil {
+		return err
+	}
+
+	if err := htmlReportTemplate.Execute(outfile, data); err != nil {
+		outfile.Close()
+		return err
+	}
+	if err := outfile.Close(); err != nil {
+		return err
+	}
+
+	logStat.Printf("[MAIN] HTML report has been written to %s", reportPath)
+	return nil
+}
+
+func phaseTimeTick(phase phaseReport) func(x float64) string {
+	return func(x float64) string {
+		return phase.StartTime.Truncate(time.Second).Add(time.Duration(x) * time.Second).Format("15:04:05")
+	}
+}
+
+func throughputSeries(name string, throughput []throughputPoint, value func(point throughputPoint) float64) chartSeries {
+	series := chartSeries{name: name}
+	for second, point := range throughput {
+		series.points = append(series.points, chartPoint{x: float64(second), y: value(point)})
+	}
+	return series
+}
+
+func throughputChart(phase phaseReport) lineChart {
+	chart := lineChart{
+		title:       "Throughput over time",
+		xLabel:      "Time",
+		yLabel:      "Requests per second",
+		formatXTick: phaseTimeTick(phase),
+	}
+
+	requests := func(point throughputPoint) float64 { return float64(point.Requests) }
+	chart.series = append(chart.series, throughputSeries("all", phase.AllRequests.Throughput, requests))
+	for _, endpoint := range phase.Endpoints {
+		chart.series = append(chart.series, throughputSeries(endpoint.Endpoint, endpoint.Throughput, requests))
+	}
+
+	return chart
+}
+
+func errorRateChart(phase phaseReport) lineChart {
+	chart := lineChart{
+		title:       "Error rate over time",
+		xLabel:      "Time",
+		yLabel:      "Errors per second",
+		formatXTick: phaseTimeTick(phase),
+	}
+
+	errors := func(point throughputPoint) float64 { return float64(point.Errors) }
+	chart.series = append(chart.series, throughputSeries("all", phase.AllRequests.Throughput, errors))
+	for _, endpoint := range phase.Endpoints {
+		chart.series = append(chart.series, throughputSeries(endpoint.Endpoint, endpoint.Throughput, errors))
+	}
+
+	return chart
+}
+
+func latencyClientsNumChart(phase phaseReport, percentiles []float64) lineChart {
+	chart := lineChart{
+		title:  "Response time at a certain number of clients",
+		xLabel: "Clients",
+		yLabel: "Response time, ms",
+	}
+
+	average := chartSeries{name: "average"}
+	for _, level := range phase.AllRequests.ClientsNum {
+		average.points = append(average.points, chartPoint{x: float64(level.Clients), y: level.Latency.MeanMs})
+	}
+	chart.series = append(chart.series, average)
+
+	for _, percentile := range percentiles {
+		key := percentileKey(percentile)
+		series := chartSeries{name: percentileLabel(percentile)}
+		for _, level := range phase.AllRequests.ClientsNum {
+			series.points = append(series.points, chartPoint{x: float64(level.Clients), y: level.Latency.Percentiles[key]})
+		}
+		chart.series = append(chart.series, series)
+	}
+
+	return chart
+}
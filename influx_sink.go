@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	influxMeasurement      = "load_generator_requests"
+	influxMaxDatagramBytes = 1400
+)
+
+// influxSink writes the aggregated series in InfluxDB line protocol, either posting them to a write
+// endpoint such as http://localhost:8086/write?db=loadtest or sending them to a udp://host:port listener
+type influxSink struct {
+	aggregator metricsAggregator
+
+	writeUrl   string
+	httpClient *http.Client
+	udpConn    net.Conn
+}
+
+func newInfluxSink(rawUrl string) (*influxSink, error) {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid InfluxDB URL %q: %s", rawUrl, err)
+	}
+
+	switch parsedUrl.Scheme {
+	case "http", "https":
+		return &influxSink{writeUrl: rawUrl, httpClient: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "udp":
+		udpConn, err := net.Dial("udp", parsedUrl.Host)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open InfluxDB UDP socket: %s", err)
+		}
+		return &influxSink{udpConn: udpConn}, nil
+	}
+	return nil, fmt.Errorf("invalid InfluxDB URL %q: an http, https or udp URL is expected", rawUrl)
+}
+
+func (sink *influxSink) name() string {
+	if sink.udpConn != nil {
+		return "InfluxDB udp://" + sink.udpConn.RemoteAddr().String()
+	}
+	return "InfluxDB " + sink.writeUrl
+}
+
+func (sink *influxSink) record(metric requestMetric) {
+	sink.aggregator.record(metric)
+}
+
+func influxEscape(value string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(value)
+}
+
+func influxLines(series map[metricSeriesKey]*metricSeries, flushTime time.Time) []string {
+	lines := make([]string, 0, len(series))
+
+	for key, values := range series {
+		line := &strings.Builder{}
+		line.WriteString(influxMeasurement)
+
+		tags := [][2]string{{"endpoint", key.endpoint}, {"encoding", key.encoding}, {"phase", key.phase}, {"status", key.status}}
+		for _, tag := range tags {
+			if tag[1] != "" {
+				fmt.Fprintf(line, ",%s=%s", tag[0], influxEscape(tag[1]))
+			}
+		}
+
+		for index, field := range values.fields() {
+			separator := ","
+			if index == 0 {
+				separator = " "
+			}
+			fmt.Fprintf(line, "%s%s=%s", separator, field.name, field.format())
+			if field.integer {
+				line.WriteString("i")
+			}
+		}
+
+		fmt.Fprintf(line, " %d", flushTime.UnixNano())
+		lines = append(lines, line.String())
+	}
+
+	sort.Strings(lines)
+	return lines
+}
+
+func (sink *influxSink) flush(flushTime time.Time) error {
+	series := sink.aggregator.take()
+	if len(series) == 0 {
+		return nil
+	}
+	lines := influxLines(series, flushTime)
+
+	if sink.udpConn != nil {
+		return sink.sendDatagrams(lines)
+	}
+
+	response, err := sink.httpClient.Post(sink.writeUrl, "text/plain; charset=utf-8",
+		strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", response.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// sendDatagrams packs as many lines into a datagram as fit into a common MTU
+func (sink *influxSink) sendDatagrams(lines []string) error {
+	datagram := &bytes.Buffer{}
+
+	for _, line := range lines {
+		if datagram.Len() > 0 && datagram.Len()+len(line)+1 > influxMaxDatagramBytes {
+			if _, err := sink.udpConn.Write(datagram.Bytes()); err != nil {
+				return err
+			}
+			datagram.Reset()
+		}
+		datagram.WriteString(line)
+		datagram.WriteByte('\n')
+	}
+
+	if datagram.Len() > 0 {
+		_, err := sink.udpConn.Write(datagram.Bytes())
+		return err
+	}
+	return nil
+}
+
+func (sink *influxSink) close() error {
+	if sink.udpConn != nil {
+		return sink.udpConn.Close()
+	}
+	return nil
+}
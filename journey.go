@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const errorClassExtractionFailed = "extraction_failed"
+
+// Journey replaces the built-in browse-then-buy client message with a sequence of steps. A step renders
+// ${variable} templates into its path, query params and body, sends the request, and extracts values
+// from the response into variables for the later steps. The values rendered into the query params are
+// URL-escaped.
+//
+// Every journey starts with the variables clientName, clientNumber and messageNumber. A step with ForEach
+// is sent once per value of that variable, the value being ${item} and its position ${itemIndex}.
+// A failed step ends the journey once all its requests have been sent. The ThinkTime of a step, such as
+// "uniform:1s,3s", is waited after its requests before the next step, the journey duration includes it.
+//
+// A scenario may mix several journeys: every client message picks one of them with a probability
+// proportional to its Weight.
+type Journey struct {
+	Name   string        `json:"name,omitempty"`
+	Weight float64       `json:"weight,omitempty"`
+	Steps  []JourneyStep `json:"steps"`
+}
+
+// JourneyStep is a request to an endpoint, any path of the tested server such as "/cart". Its response is
+// validated by the validators of the endpoint, which only check the status 200 unless the scenario lists
+// some. The endpoints "/" and "/buy" also have a built-in expected response, OracleName is the name it is
+// computed for, such as ${item}.
+type JourneyStep struct {
+	Name        string        `json:"name,omitempty"`
+	Endpoint    string        `json:"endpoint"`
+	Path        string        `json:"path,omitempty"`
+	Query       string        `json:"query,omitempty"`
+	Body        string        `json:"body,omitempty"`
+	ContentType string        `json:"contentType,omitempty"`
+	OracleName  string        `json:"oracleName,omitempty"`
+	ForEach     string        `json:"forEach,omitempty"`
+	Extract     []Extraction  `json:"extract,omitempty"`
+	ThinkTime   *distribution `json:"thinkTime,omitempty"`
+}
+
+// Extraction stores the values one of JsonPath, Regex or Header selects in a response into the variable
+// Var. Regex values are the first capture group of every match, or the whole match without groups.
+// A step fails when an extraction selects nothing.
+type Extraction struct {
+	Var      string `json:"var"`
+	JsonPath string `json:"jsonpath,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+	Header   string `json:"header,omitempty"`
+}
+
+type compiledExtraction struct {
+	variable string
+	jsonPath *jsonPath
+	regex    *regexp.Regexp
+	header   string
+}
+
+type compiledStep struct {
+	JourneyStep
+	extractions []compiledExtraction
+}
+
+type compiledJourney struct {
+	name  string
+	steps []compiledStep
+}
+
+// journeyMix picks the journey of a client message by the journey weights
+type journeyMix struct {
+	journeys          []*compiledJourney
+	cumulativeWeights []float64
+}
+
+var (
+	journeyTemplateVariable = regexp.MustCompile(`\$\{(\w+)\}`)
+	journeyVariableName     = regexp.MustCompile(`^\w+$`)
+
+	journeyBuiltInVariables = []string{"clientName", "clientNumber", "messageNumber"}
+
+	endpointOracles = map[string]func(objectName string) string{
+		"/":    getExpectedGetItemsResponse,
+		"/buy": getExpectedBuyItemsResponse,
+	}
+
+	activeJourneys *journeyMix
+)
+
+func (extraction Extraction) compile() (compiledExtraction, error) {
+	compiled := compiledExtraction{variable: extraction.Var, header: extraction.Header}
+	if !journeyVariableName.MatchString(extraction.Var) {
+		return compiled, fmt.Errorf("invalid variable name %q", extraction.Var)
+	}
+
+	sourcesNum := 0
+	if extraction.JsonPath != "" {
+		path, err := parseJsonPath(extraction.JsonPath)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.jsonPath = &path
+		sourcesNum++
+	}
+	if extraction.Regex != "" {
+		regex, err := regexp.Compile(extraction.Regex)
+		if err != nil {
+			return compiled, fmt.Errorf("invalid regex: %s", err)
+		}
+		compiled.regex = regex
+		sourcesNum++
+	}
+	if extraction.Header != "" {
+		sourcesNum++
+	}
+
+	if sourcesNum != 1 {
+		return compiled, fmt.Errorf("extraction of %s needs exactly one of jsonpath, regex and header", extraction.Var)
+	}
+	return compiled, nil
+}
+
+func builtInJourneyVariables() map[string]bool {
+	definedVariables := make(map[string]bool)
+	for _, variable := range journeyBuiltInVariables {
+		definedVariables[variable] = true
+	}
+	return definedVariables
+}
+
+// compileJourney checks that every step targets an endpoint path and only uses variables that are
+// defined by then, definedVariables are the variables known before the first step and are extended
+// by the extractions of the steps
+func compileJourney(journey Journey, definedVariables map[string]bool) (*compiledJourney, error) {
+	if len(journey.Steps) == 0 {
+		return nil, fmt.Errorf("journey %s: no steps defined", journey.Name)
+	}
+
+	compiled := &compiledJourney{name: journey.Name}
+
+	for index, step := range journey.Steps {
+		stepName := step.Name
+		if stepName == "" {
+			stepName = strconv.Itoa(index)
+		}
+
+		if !strings.HasPrefix(step.Endpoint, "/") {
+			return nil, fmt.Errorf("journey %s, step %s: invalid endpoint %q, a path starting with / is expected",
+				journey.Name, stepName, step.Endpoint)
+		}
+		if _, ok := endpointOracles[step.Endpoint]; !ok && step.OracleName != "" {
+			return nil, fmt.Errorf("journey %s, step %s: endpoint %s has no built-in expected response, "+
+				"so oracleName is not supported", journey.Name, stepName, step.Endpoint)
+		}
+		switch step.ContentType {
+		case "", "application/x-www-form-urlencoded", "multipart/form-data":
+		default:
+			return nil, fmt.Errorf("journey %s, step %s: unsupported content type %q", journey.Name, stepName, step.ContentType)
+		}
+		if step.ForEach != "" && !definedVariables[step.ForEach] {
+			return nil, fmt.Errorf("journey %s, step %s: forEach variable %q is not defined", journey.Name, stepName, step.ForEach)
+		}
+
+		stepVariables := definedVariables
+		if step.ForEach != "" {
+			stepVariables = map[string]bool{"item": true, "itemIndex": true}
+			for variable := range definedVariables {
+				stepVariables[variable] = true
+			}
+		}
+		for _, template := range []string{step.Path, step.Query, step.Body, step.OracleName} {
+			for _, match := range journeyTemplateVariable.FindAllStringSubmatch(template, -1) {
+				if !stepVariables[match[1]] {
+					return nil, fmt.Errorf("journey %s, step %s: variable %q is not defined", journey.Name, stepName, match[1])
+				}
+			}
+		}
+
+		compiledStep := compiledStep{JourneyStep: step}
+		for _, extraction := range step.Extract {
+			compiledExtraction, err := extraction.compile()
+			if err != nil {
+				return nil, fmt.Errorf("journey %s, step %s: %s", journey.Name, stepName, err)
+			}
+			compiledStep.extractions = append(compiledStep.extractions, compiledExtraction)
+			definedVariables[extraction.Var] = true
+		}
+		compiled.steps = append(compiled.steps, compiledStep)
+	}
+
+	return compiled, nil
+}
+
+// compileJourneys checks the journeys of a scenario, nil journeys keep the built-in client message
+func compileJourneys(journeys []Journey) (*journeyMix, error) {
+	if len(journeys) == 0 {
+		return nil, nil
+	}
+
+	mix := &journeyMix{}
+	names := make(map[string]bool)
+	var totalWeight float64
+
+	for index, journey := range journeys {
+		if journey.Name == "" {
+			if len(journeys) > 1 {
+				return nil, fmt.Errorf("journey %d: name is required when several journeys are mixed", index)
+			}
+			journey.Name = "journey"
+		}
+		if names[journey.Name] {
+			return nil, fmt.Errorf("journey %s: duplicate name", journey.Name)
+		}
+		names[journey.Name] = true
+
+		if journey.Weight < 0 || (journey.Weight == 0 && len(journeys) > 1) {
+			return nil, fmt.Errorf("journey %s: weight must be positive", journey.Name)
+		}
+
+		compiled, err := compileJourney(journey, builtInJourneyVariables())
+		if err != nil {
+			return nil, err
+		}
+
+		totalWeight += journey.Weight
+		mix.journeys = append(mix.journeys, compiled)
+		mix.cumulativeWeights = append(mix.cumulativeWeights, totalWeight)
+	}
+
+	return mix, nil
+}
+
+func setJourneys(journeys []Journey) error {
+	mix, err := compileJourneys(journeys)
+	if err != nil {
+		return err
+	}
+	activeJourneys = mix
+	return nil
+}
+
+func (mix *journeyMix) pick(clientRandom *rand.Rand) *compiledJourney {
+	if len(mix.journeys) == 1 {
+		return mix.journeys[0]
+	}
+
+	point := clientRandom.Float64() * mix.cumulativeWeights[len(mix.cumulativeWeights)-1]
+	index := sort.SearchFloat64s(mix.cumulativeWeights, point)
+	if index >= len(mix.journeys) {
+		index = len(mix.journeys) - 1
+	}
+	return mix.journeys[index]
+}
+
+// journeyVariables holds the values of the variables of one journey run, a variable may have several
+// values, such as all the item names of a response, and renders to its first one
+type journeyVariables map[string][]string
+
+func (variables journeyVariables) render(template string) string {
+	return variables.renderEscaped(template, func(value string) string { return value })
+}
+
+// renderQuery renders a query template, the values are escaped so an extracted value with & or = in it
+// stays one query param value
+func (variables journeyVariables) renderQuery(template string) string {
+	return variables.renderEscaped(template, url.QueryEscape)
+}
+
+func (variables journeyVariables) renderEscaped(template string, escape func(value string) string) string {
+	return journeyTemplateVariable.ReplaceAllStringFunc(template, func(reference string) string {
+		if values := variables[reference[2:len(reference)-1]]; len(values) > 0 {
+			return escape(values[0])
+		}
+		return ""
+	})
+}
+
+func (extraction compiledExtraction) extract(result requestResult) ([]string, error) {
+	var values []string
+
+	switch {
+	case extraction.jsonPath != nil:
+		var document interface{}
+		if err := json.Unmarshal([]byte(result.body), &document); err != nil {
+			return nil, fmt.Errorf("unable to extract %s: invalid JSON response body: %s", extraction.variable, err)
+		}
+		for _, value := range extraction.jsonPath.selectValues(document) {
+			values = append(values, jsonText(value))
+		}
+	case extraction.regex != nil:
+		for _, match := range extraction.regex.FindAllStringSubmatch(result.body, -1) {
+			if len(match) > 1 {
+				values = append(values, match[1])
+			} else {
+				values = append(values, match[0])
+			}
+		}
+	default:
+		values = append(values, result.header[http.CanonicalHeaderKey(extraction.header)]...)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("unable to extract %s: nothing matched", extraction.variable)
+	}
+	return values, nil
+}
+
+// run sends the steps of the journey as one client message and records how long the journey took
+func (journey *compiledJourney) run(userName, contentType string, currentClientNumber, currentMessageNumber int,
+	clientRandom *rand.Rand, schedule messageSchedule) {
+
+	startTime := time.Now()
+	variables := newJourneyVariables(userName, currentClientNumber, currentMessageNumber)
+	failure, _ := journey.runSteps(variables, contentType, currentClientNumber, currentMessageNumber, clientRandom, schedule)
+	duration := time.Since(startTime)
+
+	failureClass := ""
+	if failure != nil {
+		failureClass = failure.class
+	}
+	currentPhaseStats.recordJourney(journey.name, duration, failureClass)
+	writeSample(sampleRecord{kind: sampleKindJourney, time: startTime, elapsed: duration, message: journey.name,
+		errorClass: failureClass})
+}
+
+func newJourneyVariables(userName string, currentClientNumber, currentMessageNumber int) journeyVariables {
+	return journeyVariables{
+		"clientName":    {userName},
+		"clientNumber":  {strconv.Itoa(currentClientNumber)},
+		"messageNumber": {strconv.Itoa(currentMessageNumber)},
+	}
+}
+
+// runSteps sends the steps with the given variables, which collect the extracted values. It returns
+// the first error of the failed step, nil when the journey completed, and the time spent in the think
+// times between the steps. Every step is measured from its own send time and only the lateness of the
+// schedule is added to its corrected response time, never the earlier steps or think times.
+func (journey *compiledJourney) runSteps(variables journeyVariables, contentType string, currentClientNumber,
+	currentMessageNumber int, clientRandom *rand.Rand, schedule messageSchedule) (*ErrResponse, time.Duration) {
+
+	var thinkTime time.Duration
+
+	for stepIndex, step := range journey.steps {
+		items := []string{""}
+		if step.ForEach != "" {
+			items = variables[step.ForEach]
+		}
+
+		var failure *ErrResponse
+		for itemIndex, item := range items {
+			stepVariables := variables
+			if step.ForEach != "" {
+				stepVariables = journeyVariables{"item": {item}, "itemIndex": {strconv.Itoa(itemIndex)}}
+				for variable, values := range variables {
+					stepVariables[variable] = values
+				}
+			}
+
+			if stepFailure := journey.runStep(step, stepVariables, variables, contentType, currentClientNumber,
+				currentMessageNumber, itemIndex, schedule); stepFailure != nil && failure == nil {
+				failure = stepFailure
+			}
+		}
+
+		if failure != nil {
+			logInfo.Printf("[Goroutine %d][Message %d][Journey %s] Step %d failed, the journey is over",
+				currentClientNumber, currentMessageNumber, journey.name, stepIndex)
+			return failure, thinkTime
+		}
+
+		if step.ThinkTime != nil && stepIndex < len(journey.steps)-1 {
+			thinkStartTime := time.Now()
+			time.Sleep(step.ThinkTime.sample(clientRandom))
+			thinkTime += time.Since(thinkStartTime)
+		}
+	}
+
+	return nil, thinkTime
+}
+
+// runStep sends one request of a step and stores the extracted values, it returns the error of a failed step
+func (journey *compiledJourney) runStep(step compiledStep, stepVariables, variables journeyVariables,
+	contentType string, currentClientNumber, currentMessageNumber, itemIndex int, schedule messageSchedule) *ErrResponse {
+
+	atomic.AddUint32(&currentPhaseStats.sentRequestsCount, 1)
+
+	if step.ContentType != "" {
+		contentType = step.ContentType
+	}
+	params := requestParams{
+		endpoint:    step.Endpoint,
+		path:        stepVariables.render(step.Path),
+		queryParams: stepVariables.renderQuery(step.Query),
+		contentType: contentType,
+		body:        stepVariables.render(step.Body),
+	}
+
+	span := startRequestSpan(step.Endpoint, currentClientNumber, currentMessageNumber, itemIndex)
+	result := sendRequest(params, schedule, span)
+
+	resultCheck := checkResponse(step.Endpoint, stepVariables.render(step.OracleName), result, endpointOracles[step.Endpoint])
+	if resultCheck == nil {
+		for _, extraction := range step.extractions {
+			values, err := extraction.extract(result)
+			if err != nil {
+				resultCheck = &ErrResponse{time: time.Now(), class: errorClassExtractionFailed, message: err.Error()}
+				break
+			}
+			variables[extraction.variable] = values
+		}
+	}
+	span.end(resultCheck)
+
+	if resultCheck != nil {
+		logError.Printf("[Goroutine %d][Message %d][Journey %s][%s] Got invalid response. "+
+			"Error Message: %s", currentClientNumber, currentMessageNumber, journey.name, step.Endpoint, resultCheck)
+
+		currentPhaseStats.recordError(step.Endpoint, *resultCheck)
+		writeSample(sampleRecord{kind: sampleKindError, endpoint: step.Endpoint, time: resultCheck.time,
+			errorClass: resultCheck.class, message: resultCheck.message, traceId: span.traceIdString()})
+		return resultCheck
+	}
+
+	logInfo.Printf("[Goroutine %d][Message %d][Journey %s][%s] Got valid response",
+		currentClientNumber, currentMessageNumber, journey.name, step.Endpoint)
+	return nil
+}
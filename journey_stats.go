@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// journeyStats collects the runs of one journey in a phase, the duration covers all the steps of a run
+type journeyStats struct {
+	duration       *histogram
+	completed      uint64
+	failed         uint64
+	failureClasses map[string]uint64
+}
+
+func newJourneyStats() *journeyStats {
+	return &journeyStats{duration: newHistogram(histogramSignificantDigits), failureClasses: make(map[string]uint64)}
+}
+
+func (stats *journeyStats) merge(other *journeyStats) {
+	stats.duration.merge(other.duration)
+	stats.completed += other.completed
+	stats.failed += other.failed
+	for class, count := range other.failureClasses {
+		stats.failureClasses[class] += count
+	}
+}
+
+// recordJourneyRun records a run into the runs by name, failureClass is the error class of the failed step or empty
+func recordJourneyRun(runs map[string]*journeyStats, name string, duration time.Duration, failureClass string) {
+	journey, ok := runs[name]
+	if !ok {
+		journey = newJourneyStats()
+		runs[name] = journey
+	}
+
+	journey.duration.record(duration)
+	if failureClass == "" {
+		journey.completed++
+	} else {
+		journey.failed++
+		journey.failureClasses[failureClass]++
+	}
+}
+
+func mergeJourneyRuns(runs, otherRuns map[string]*journeyStats) {
+	for name, otherJourney := range otherRuns {
+		journey, ok := runs[name]
+		if !ok {
+			journey = newJourneyStats()
+			runs[name] = journey
+		}
+		journey.merge(otherJourney)
+	}
+}
+
+func (stats *phaseStats) recordJourney(name string, duration time.Duration, failureClass string) {
+	stats.muxJourneys.Lock()
+	defer stats.muxJourneys.Unlock()
+
+	recordJourneyRun(stats.journeys, name, duration, failureClass)
+}
+
+// mergeJourneys merges the journey runs and the user model state visits of the other phase
+func (stats *phaseStats) mergeJourneys(other *phaseStats) {
+	other.muxJourneys.Lock()
+	defer other.muxJourneys.Unlock()
+	stats.muxJourneys.Lock()
+	defer stats.muxJourneys.Unlock()
+
+	mergeJourneyRuns(stats.journeys, other.journeys)
+	mergeJourneyRuns(stats.userStates, other.userStates)
+	for name, otherDwellTimes := range other.userStateDwellTimes {
+		dwellTimes, ok := stats.userStateDwellTimes[name]
+		if !ok {
+			dwellTimes = newHistogram(histogramSignificantDigits)
+			stats.userStateDwellTimes[name] = dwellTimes
+		}
+		dwellTimes.merge(otherDwellTimes)
+	}
+}
+
+type journeyReport struct {
+	Name           string            `json:"name"`
+	Runs           uint64            `json:"runs"`
+	SharePercent   float64           `json:"sharePercent"`
+	Completed      uint64            `json:"completed"`
+	Failed         uint64            `json:"failed"`
+	FailureClasses map[string]uint64 `json:"failureClasses"`
+	Duration       latencyReport     `json:"duration"`
+}
+
+func (stats *phaseStats) journeyReports() []journeyReport {
+	stats.muxJourneys.Lock()
+	defer stats.muxJourneys.Unlock()
+
+	return journeyRunReports(stats.journeys)
+}
+
+// journeyRunReports reports the runs sorted by name, the share of a run is its part of all the runs
+func journeyRunReports(runs map[string]*journeyStats) []journeyReport {
+	var reports []journeyReport
+	var totalRuns uint64
+	for name, journey := range runs {
+		report := journeyReport{
+			Name:           name,
+			Runs:           journey.completed + journey.failed,
+			Completed:      journey.completed,
+			Failed:         journey.failed,
+			FailureClasses: make(map[string]uint64),
+			Duration:       newLatencyReport(journey.duration),
+		}
+		for class, count := range journey.failureClasses {
+			report.FailureClasses[class] = count
+		}
+		totalRuns += report.Runs
+		reports = append(reports, report)
+	}
+
+	for index := range reports {
+		if totalRuns > 0 {
+			reports[index].SharePercent = float64(reports[index].Runs) * 100 / float64(totalRuns)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+
+	return reports
+}
+
+func showJourneyStat(stats *phaseStats) {
+	reports := stats.journeyReports()
+	if len(reports) == 0 {
+		return
+	}
+
+	logStat.Print("Journey statistics:")
+
+	header := "Journey	Runs	Share in %	Completed	Failed	Average duration in ms"
+	for _, percentile := range reportPercentiles {
+		header += "	" + percentileName(percentile) + " percentile in ms"
+	}
+	logStat.Print(header + "	Max in ms")
+
+	for _, report := range reports {
+		row := fmt.Sprintf("%s	%d	%f	%d	%d	%f", report.Name, report.Runs, report.SharePercent,
+			report.Completed, report.Failed, report.Duration.MeanMs)
+		for _, percentile := range reportPercentiles {
+			row += fmt.Sprintf("	%f", report.Duration.Percentiles[percentileKey(percentile)])
+		}
+		logStat.Printf("%s	%f", row, report.Duration.MaxMs)
+	}
+}
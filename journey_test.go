@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileJourneyEndpoints(t *testing.T) {
+	tests := []struct {
+		step  JourneyStep
+		error string
+	}{
+		{step: JourneyStep{Endpoint: "/", OracleName: "${clientName}"}},
+		{step: JourneyStep{Endpoint: "/cart", Query: "user=${clientName}"}},
+		{step: JourneyStep{Endpoint: "cart"}, error: "a path starting with / is expected"},
+		{step: JourneyStep{Endpoint: "/cart", OracleName: "${clientName}"}, error: "no built-in expected response"},
+	}
+
+	for _, test := range tests {
+		_, err := compileJourney(Journey{Name: "test", Steps: []JourneyStep{test.step}}, builtInJourneyVariables())
+		if test.error == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", test.step.Endpoint, err)
+		}
+		if test.error != "" && (err == nil || !strings.Contains(err.Error(), test.error)) {
+			t.Errorf("%s: error is %v, expected %q", test.step.Endpoint, err, test.error)
+		}
+	}
+}
+
+func TestBuildValidatorsOfEndpointWithoutOracle(t *testing.T) {
+	if _, err := buildValidators(map[string][]ValidatorSpec{"/cart": {{Type: validatorStatus, Codes: []int{201}}}}); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if _, err := buildValidators(map[string][]ValidatorSpec{"/cart": {{Type: validatorExact}}}); err == nil {
+		t.Error("an exact validator was accepted for an endpoint without a built-in expected response")
+	}
+}
+
+func TestPhaseStatsCreateEndpointsOnFirstUse(t *testing.T) {
+	startTime := time.Now()
+	stats := newPhaseStats("test", startTime)
+	stats.recordResponseTime("/cart", ResponseTime{elapsedTime: time.Millisecond, timeWhileSendingRequest: startTime,
+		intendedSendTime: startTime})
+	stats.recordError("/cart", ErrResponse{time: startTime, class: statusErrorClass(404), message: "wrong status code: 404"})
+	stats.recordError("/account", ErrResponse{time: startTime, class: errorClassTimeout, message: "timeout"})
+
+	if names := strings.Join(stats.endpointNames(), " "); names != "/ /buy /account /cart" {
+		t.Errorf("endpoints are %s, expected / /buy /account /cart", names)
+	}
+	if count := stats.endpoint("/cart").responseTime.count(); count != 1 {
+		t.Errorf("/cart has %d responses, expected 1", count)
+	}
+	if count := stats.allEndpoints().errorsCount(); count != 2 {
+		t.Errorf("all endpoints have %d errors, expected 2", count)
+	}
+
+	merged := newPhaseStats("test", startTime)
+	merged.merge(stats.snapshot().phaseStats())
+	if count := merged.endpoint("/account").errorsCount(); count != 1 {
+		t.Errorf("merged /account has %d errors, expected 1", count)
+	}
+}
+
+func TestJourneyVariablesRenderQueryEscaped(t *testing.T) {
+	variables := journeyVariables{"item": {"tea & biscuits=2"}, "clientName": {"name"}}
+
+	query := variables.renderQuery("name=${clientName}&item=${item}&missing=${missing}")
+	if expected := "name=name&item=tea+%26+biscuits%3D2&missing="; query != expected {
+		t.Errorf("query is %s, expected %s", query, expected)
+	}
+	if body := variables.render(`{"item":"${item}"}`); body != `{"item":"tea & biscuits=2"}` {
+		t.Errorf("body is %s, the body must not be escaped", body)
+	}
+}
+
+func TestJourneyStepsAreMeasuredWithoutEarlierStepsAndThinkTimes(t *testing.T) {
+	startIdleTestShop(t)
+
+	thinkTime := &distribution{kind: distributionConstant, params: []time.Duration{20 * time.Millisecond}}
+	journey, err := compileJourney(Journey{Name: "browse twice", Steps: []JourneyStep{
+		{Endpoint: "/", Query: "name=${clientName}", OracleName: "${clientName}", ThinkTime: thinkTime},
+		{Endpoint: "/", Query: "name=${clientName}", OracleName: "${clientName}"},
+	}}, builtInJourneyVariables())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intendedTime := time.Now()
+	journey.run("ticketbright", "application/x-www-form-urlencoded", 0, 0, rand.New(rand.NewSource(1)),
+		arrivalRateIteration{intendedTime: intendedTime}.schedule(intendedTime))
+
+	if count := currentPhaseStats.endpoint("/").responseTime.count(); count != 2 {
+		t.Fatalf("the journey sent %d requests, expected 2", count)
+	}
+	checkCorrectedEqualsRaw(t, "/")
+
+	currentPhaseStats = newPhaseStats("late", time.Now())
+	journey.run("ticketbright", "application/x-www-form-urlencoded", 0, 1, rand.New(rand.NewSource(1)),
+		arrivalRateIteration{intendedTime: intendedTime}.schedule(intendedTime.Add(100*time.Millisecond)))
+
+	endpoint := currentPhaseStats.endpoint("/")
+	if lateness := endpoint.correctedResponseTime.min() - endpoint.responseTime.min(); lateness < 99*time.Millisecond ||
+		lateness > 101*time.Millisecond {
+		t.Errorf("the steps of a journey 100ms late are corrected by %v", lateness)
+	}
+	if lateness := endpoint.correctedResponseTime.max() - endpoint.responseTime.max(); lateness > 101*time.Millisecond {
+		t.Errorf("the corrected response time of the last step includes the think time: %v more than raw", lateness)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JsonPathAssertion checks the values a JSONPath selects in a response body. The supported paths are
+// made of $, .name, ['name'], [index] and the wildcards .* and [*], such as $.items[*].price.
+//
+// Exists checks whether the path selects anything, Equals requires every selected value to equal the
+// given JSON value and Pattern requires every selected value to match the regular expression. Equals
+// and Pattern fail when the path selects nothing.
+type JsonPathAssertion struct {
+	Path    string          `json:"path"`
+	Exists  *bool           `json:"exists,omitempty"`
+	Equals  json.RawMessage `json:"equals,omitempty"`
+	Pattern string          `json:"pattern,omitempty"`
+}
+
+// jsonPathStep selects an object member by name, an array item by index, or every member or item
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+type jsonPath struct {
+	expression string
+	steps      []jsonPathStep
+}
+
+type jsonPathAssertion struct {
+	path      jsonPath
+	exists    *bool
+	equals    interface{}
+	hasEquals bool
+	pattern   *regexp.Regexp
+}
+
+func parseJsonPath(expression string) (jsonPath, error) {
+	path := jsonPath{expression: expression}
+	if !strings.HasPrefix(expression, "$") {
+		return path, fmt.Errorf("JSONPath %q must start with $", expression)
+	}
+
+	rest := expression[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return path, fmt.Errorf("JSONPath %q has an empty member name", expression)
+			}
+			path.steps = append(path.steps, jsonPathStep{name: name, wildcard: name == "*"})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return path, fmt.Errorf("JSONPath %q has an unclosed [", expression)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+
+			switch {
+			case selector == "*":
+				path.steps = append(path.steps, jsonPathStep{wildcard: true})
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				path.steps = append(path.steps, jsonPathStep{name: selector[1 : len(selector)-1]})
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return path, fmt.Errorf("JSONPath %q has an invalid selector [%s]", expression, selector)
+				}
+				path.steps = append(path.steps, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			return path, fmt.Errorf("JSONPath %q: unexpected %q", expression, rest)
+		}
+	}
+
+	return path, nil
+}
+
+// selectValues returns the values the path selects in a decoded JSON document
+func (path jsonPath) selectValues(document interface{}) []interface{} {
+	values := []interface{}{document}
+
+	for _, step := range path.steps {
+		var selected []interface{}
+		for _, value := range values {
+			switch typedValue := value.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					for _, member := range typedValue {
+						selected = append(selected, member)
+					}
+				} else if member, ok := typedValue[step.name]; ok && !step.isIndex {
+					selected = append(selected, member)
+				}
+			case []interface{}:
+				if step.wildcard {
+					selected = append(selected, typedValue...)
+				} else if step.isIndex {
+					index := step.index
+					if index < 0 {
+						index += len(typedValue)
+					}
+					if index >= 0 && index < len(typedValue) {
+						selected = append(selected, typedValue[index])
+					}
+				}
+			}
+		}
+		values = selected
+	}
+
+	return values
+}
+
+func (assertion JsonPathAssertion) compile() (jsonPathAssertion, error) {
+	path, err := parseJsonPath(assertion.Path)
+	if err != nil {
+		return jsonPathAssertion{}, err
+	}
+
+	compiled := jsonPathAssertion{path: path, exists: assertion.Exists}
+
+	if len(assertion.Equals) > 0 {
+		if err := json.Unmarshal(assertion.Equals, &compiled.equals); err != nil {
+			return compiled, fmt.Errorf("assertion on %s: invalid equals value: %s", assertion.Path, err)
+		}
+		compiled.hasEquals = true
+	}
+
+	if assertion.Pattern != "" {
+		if compiled.pattern, err = regexp.Compile(assertion.Pattern); err != nil {
+			return compiled, fmt.Errorf("assertion on %s: invalid pattern: %s", assertion.Path, err)
+		}
+	}
+
+	if compiled.exists == nil && !compiled.hasEquals && compiled.pattern == nil {
+		return compiled, errors.New("assertion on " + assertion.Path + ": exists, equals or pattern is required")
+	}
+	return compiled, nil
+}
+
+// jsonText is the text a pattern is matched against: strings as they are, other values as JSON
+func jsonText(value interface{}) string {
+	if text, ok := value.(string); ok {
+		return text
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+func (assertion jsonPathAssertion) check(document interface{}) error {
+	values := assertion.path.selectValues(document)
+	expression := assertion.path.expression
+
+	if assertion.exists != nil && *assertion.exists != (len(values) > 0) {
+		if *assertion.exists {
+			return fmt.Errorf("%s does not exist", expression)
+		}
+		return fmt.Errorf("%s exists", expression)
+	}
+
+	if (assertion.hasEquals || assertion.pattern != nil) && len(values) == 0 {
+		return fmt.Errorf("%s does not exist", expression)
+	}
+
+	for _, value := range values {
+		if assertion.hasEquals && !reflect.DeepEqual(value, assertion.equals) {
+			return fmt.Errorf("%s is %s, expected %s", expression, jsonText(value), jsonText(assertion.equals))
+		}
+		if assertion.pattern != nil && !assertion.pattern.MatchString(jsonText(value)) {
+			return fmt.Errorf("%s is %s, expected to match %s", expression, jsonText(value), assertion.pattern)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// jsonSchema is the subset of JSON Schema that response bodies are usually checked with: type, enum, const,
+// properties, required, additionalProperties, items, the length, size and range limits, and pattern.
+type jsonSchema struct {
+	types      []string
+	enum       []interface{}
+	constValue interface{}
+	hasConst   bool
+
+	properties             map[string]*jsonSchema
+	required               []string
+	additionalProperties   *jsonSchema
+	noAdditionalProperties bool
+
+	items    *jsonSchema
+	minItems *int
+	maxItems *int
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum *float64
+	maximum *float64
+}
+
+type jsonSchemaDocument struct {
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              string                     `json:"pattern"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+}
+
+var jsonSchemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true, "number": true, "integer": true, "string": true,
+}
+
+func parseJsonSchema(data json.RawMessage) (*jsonSchema, error) {
+	var document jsonSchemaDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	schema := &jsonSchema{
+		enum:      document.Enum,
+		required:  document.Required,
+		minItems:  document.MinItems,
+		maxItems:  document.MaxItems,
+		minLength: document.MinLength,
+		maxLength: document.MaxLength,
+		minimum:   document.Minimum,
+		maximum:   document.Maximum,
+	}
+
+	if len(document.Type) > 0 {
+		var typeName string
+		if err := json.Unmarshal(document.Type, &typeName); err == nil {
+			schema.types = []string{typeName}
+		} else if err := json.Unmarshal(document.Type, &schema.types); err != nil {
+			return nil, fmt.Errorf("type must be a string or an array of strings")
+		}
+		for _, typeName := range schema.types {
+			if !jsonSchemaTypes[typeName] {
+				return nil, fmt.Errorf("unknown type %q", typeName)
+			}
+		}
+	}
+
+	if len(document.Const) > 0 {
+		json.Unmarshal(document.Const, &schema.constValue)
+		schema.hasConst = true
+	}
+
+	if document.Pattern != "" {
+		pattern, err := regexp.Compile(document.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %s", err)
+		}
+		schema.pattern = pattern
+	}
+
+	if len(document.Properties) > 0 {
+		schema.properties = make(map[string]*jsonSchema)
+		for name, propertyData := range document.Properties {
+			property, err := parseJsonSchema(propertyData)
+			if err != nil {
+				return nil, fmt.Errorf("property %q: %s", name, err)
+			}
+			schema.properties[name] = property
+		}
+	}
+
+	if len(document.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(document.AdditionalProperties, &allowed); err == nil {
+			schema.noAdditionalProperties = !allowed
+		} else {
+			additionalProperties, err := parseJsonSchema(document.AdditionalProperties)
+			if err != nil {
+				return nil, fmt.Errorf("additionalProperties: %s", err)
+			}
+			schema.additionalProperties = additionalProperties
+		}
+	}
+
+	if len(document.Items) > 0 {
+		items, err := parseJsonSchema(document.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %s", err)
+		}
+		schema.items = items
+	}
+
+	return schema, nil
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	}
+	return "unknown"
+}
+
+func (schema *jsonSchema) matchesType(value interface{}) bool {
+	if len(schema.types) == 0 {
+		return true
+	}
+
+	valueType := jsonTypeName(value)
+	for _, typeName := range schema.types {
+		if typeName == valueType {
+			return true
+		}
+		if number, ok := value.(float64); ok && typeName == "integer" && number == math.Trunc(number) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks a decoded JSON value, path is the JSONPath of the value used in the error messages
+func (schema *jsonSchema) validate(value interface{}, path string) error {
+	if !schema.matchesType(value) {
+		return fmt.Errorf("%s: expected %v, got %s", path, schema.types, jsonTypeName(value))
+	}
+
+	if schema.hasConst && !reflect.DeepEqual(value, schema.constValue) {
+		return fmt.Errorf("%s: expected the constant %v", path, schema.constValue)
+	}
+	if len(schema.enum) > 0 {
+		found := false
+		for _, enumValue := range schema.enum {
+			found = found || reflect.DeepEqual(value, enumValue)
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, value, schema.enum)
+		}
+	}
+
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		return schema.validateObject(typedValue, path)
+	case []interface{}:
+		if schema.minItems != nil && len(typedValue) < *schema.minItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, *schema.minItems, len(typedValue))
+		}
+		if schema.maxItems != nil && len(typedValue) > *schema.maxItems {
+			return fmt.Errorf("%s: expected at most %d items, got %d", path, *schema.maxItems, len(typedValue))
+		}
+		if schema.items != nil {
+			for index, item := range typedValue {
+				if err := schema.items.validate(item, fmt.Sprintf("%s[%d]", path, index)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(typedValue)
+		if schema.minLength != nil && length < *schema.minLength {
+			return fmt.Errorf("%s: expected at least %d characters, got %d", path, *schema.minLength, length)
+		}
+		if schema.maxLength != nil && length > *schema.maxLength {
+			return fmt.Errorf("%s: expected at most %d characters, got %d", path, *schema.maxLength, length)
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(typedValue) {
+			return fmt.Errorf("%s: %q does not match %s", path, typedValue, schema.pattern)
+		}
+	case float64:
+		if schema.minimum != nil && typedValue < *schema.minimum {
+			return fmt.Errorf("%s: %v is less than %v", path, typedValue, *schema.minimum)
+		}
+		if schema.maximum != nil && typedValue > *schema.maximum {
+			return fmt.Errorf("%s: %v is greater than %v", path, typedValue, *schema.maximum)
+		}
+	}
+
+	return nil
+}
+
+func (schema *jsonSchema) validateObject(object map[string]interface{}, path string) error {
+	for _, name := range schema.required {
+		if _, ok := object[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", path, name)
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := path + "." + name
+		if property, ok := schema.properties[name]; ok {
+			if err := property.validate(object[name], propertyPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if schema.noAdditionalProperties {
+			return fmt.Errorf("%s: unexpected property", propertyPath)
+		}
+		if schema.additionalProperties != nil {
+			if err := schema.additionalProperties.validate(object[name], propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// startLiveServer serves the live web dashboard, its server-sent events stream of the feed snapshots
+// and the Prometheus metrics of the run
+func startLiveServer(address string, feed *liveFeed) (*http.Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start live dashboard server: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/" {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writer.Write([]byte(liveDashboardPage))
+	})
+	mux.HandleFunc("/events", func(writer http.ResponseWriter, request *http.Request) {
+		serveLiveEvents(writer, request, feed)
+	})
+	mux.HandleFunc("/metrics", serveMetrics)
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logError.Printf("[MAIN] Live dashboard server has failed. Error: %s", err)
+		}
+	}()
+
+	logStat.Printf("[MAIN] Live dashboard is served on http://%s/, Prometheus metrics on http://%s/metrics",
+		listener.Addr(), listener.Addr())
+	return server, nil
+}
+
+func serveLiveEvents(writer http.ResponseWriter, request *http.Request, feed *liveFeed) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	snapshots := feed.subscribe()
+	defer feed.unsubscribe(snapshots)
+
+	for {
+		select {
+		case snapshot, ok := <-snapshots:
+			if !ok {
+				fmt.Fprint(writer, "event: done\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				logError.Printf("[MAIN] Unable to encode live snapshot. Error: %s", err)
+				continue
+			}
+			fmt.Fprintf(writer, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
+
+const liveDashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Load test dashboard</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; }
+td { border: 1px solid #ccc; padding: 4px 12px; }
+td:last-child { text-align: right; min-width: 120px; }
+canvas { border: 1px solid #ccc; margin: 12px 12px 0 0; }
+#status { color: #777; }
+</style>
+</head>
+<body>
+<h1>Load test dashboard</h1>
+<p id="status">Connecting...</p>
+<table>
+<tr><td>Phase</td><td id="phase"></td></tr>
+<tr><td>Active clients</td><td id="clients"></td></tr>
+<tr><td>In-flight requests</td><td id="inFlight"></td></tr>
+<tr><td>Requests per second</td><td id="rps"></td></tr>
+<tr><td>Response time p50, ms</td><td id="p50"></td></tr>
+<tr><td>Response time p95, ms</td><td id="p95"></td></tr>
+<tr><td>Response time p99, ms</td><td id="p99"></td></tr>
+<tr><td>Get items errors</td><td id="getItemsErrors"></td></tr>
+<tr><td>Buy items errors</td><td id="buyItemsErrors"></td></tr>
+</table>
+<canvas id="throughput" width="560" height="200"></canvas>
+<canvas id="latency" width="560" height="200"></canvas>
+<script>
+var snapshots = [];
+var maxPoints = 300;
+
+function draw(canvasId, title, series) {
+  var canvas = document.getElementById(canvasId), context = canvas.getContext("2d");
+  context.clearRect(0, 0, canvas.width, canvas.height);
+  context.fillStyle = "#222";
+  context.fillText(title, 8, 14);
+  var maxValue = 0;
+  series.forEach(function (line) {
+    snapshots.forEach(function (snapshot) { maxValue = Math.max(maxValue, line.value(snapshot)); });
+  });
+  if (maxValue === 0) { maxValue = 1; }
+  context.fillText(maxValue.toFixed(1), 8, 30);
+  series.forEach(function (line, index) {
+    context.strokeStyle = line.color;
+    context.fillStyle = line.color;
+    context.fillText(line.name, 80 + index * 70, 14);
+    context.beginPath();
+    snapshots.forEach(function (snapshot, point) {
+      var x = canvas.width * point / (maxPoints - 1);
+      var y = canvas.height - 4 - (canvas.height - 40) * line.value(snapshot) / maxValue;
+      if (point === 0) { context.moveTo(x, y); } else { context.lineTo(x, y); }
+    });
+    context.stroke();
+  });
+}
+
+var events = new EventSource("events");
+events.onopen = function () { document.getElementById("status").textContent = "Live"; };
+events.onerror = function () { document.getElementById("status").textContent = "Disconnected"; };
+events.addEventListener("done", function () {
+  document.getElementById("status").textContent = "The run is over";
+  events.close();
+});
+events.onmessage = function (message) {
+  var snapshot = JSON.parse(message.data);
+  snapshots.push(snapshot);
+  if (snapshots.length > maxPoints) { snapshots.shift(); }
+
+  var percentiles = snapshot.percentilesMs || {};
+  document.getElementById("status").textContent = "Live, updated at " + new Date(snapshot.time).toLocaleTimeString();
+  document.getElementById("phase").textContent = snapshot.phase + " (" + Math.floor(snapshot.phaseElapsedNs / 1e9) + " s)";
+  document.getElementById("clients").textContent = snapshot.clients;
+  document.getElementById("inFlight").textContent = snapshot.inFlight;
+  document.getElementById("rps").textContent = snapshot.requestsPerSecond;
+  ["p50", "p95", "p99"].forEach(function (key) {
+    document.getElementById(key).textContent = (percentiles[key] || 0).toFixed(3);
+  });
+  document.getElementById("getItemsErrors").textContent = snapshot.getItemsErrors;
+  document.getElementById("buyItemsErrors").textContent = snapshot.buyItemsErrors;
+
+  draw("throughput", "Requests per second", [
+    {name: "rps", color: "#1f77b4", value: function (s) { return s.requestsPerSecond; }}
+  ]);
+  draw("latency", "Response time, ms", [
+    {name: "p50", color: "#2ca02c", value: function (s) { return (s.percentilesMs || {}).p50 || 0; }},
+    {name: "p95", color: "#ff7f0e", value: function (s) { return (s.percentilesMs || {}).p95 || 0; }},
+    {name: "p99", color: "#d62728", value: function (s) { return (s.percentilesMs || {}).p99 || 0; }}
+  ]);
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	liveWindowSeconds              = 10
+	liveHistogramSignificantDigits = 2
+)
+
+// liveStats keeps what is happening right now: running clients, requests in flight, requests sent in the
+// current second and the response times of the last liveWindowSeconds seconds, kept as one histogram per second
+type liveStats struct {
+	activeClients    int64
+	inFlightRequests int64
+	sentRequests     uint64
+
+	mux           sync.RWMutex
+	currentSecond *histogram
+	recentSeconds []*histogram
+}
+
+// liveSnapshot is the state of a run at one moment, as shown by the dashboards
+type liveSnapshot struct {
+	Time              time.Time          `json:"time"`
+	Phase             string             `json:"phase"`
+	PhaseElapsed      time.Duration      `json:"phaseElapsedNs"`
+	Clients           int64              `json:"clients"`
+	InFlight          int64              `json:"inFlight"`
+	RequestsPerSecond uint64             `json:"requestsPerSecond"`
+	Percentiles       map[string]float64 `json:"percentilesMs"`
+	GetItemsErrors    int                `json:"getItemsErrors"`
+	BuyItemsErrors    int                `json:"buyItemsErrors"`
+}
+
+var (
+	liveMetrics = newLiveStats()
+
+	livePercentiles = []float64{50, 95, 99}
+)
+
+func newLiveStats() *liveStats {
+	return &liveStats{currentSecond: newHistogram(liveHistogramSignificantDigits)}
+}
+
+func (stats *liveStats) clientStarted() {
+	atomic.AddInt64(&stats.activeClients, 1)
+}
+
+func (stats *liveStats) clientFinished() {
+	atomic.AddInt64(&stats.activeClients, -1)
+}
+
+func (stats *liveStats) requestStarted() {
+	atomic.AddInt64(&stats.inFlightRequests, 1)
+	atomic.AddUint64(&stats.sentRequests, 1)
+}
+
+func (stats *liveStats) requestFinished(elapsedTime time.Duration, responded bool) {
+	atomic.AddInt64(&stats.inFlightRequests, -1)
+
+	if responded {
+		stats.mux.RLock()
+		stats.currentSecond.record(elapsedTime)
+		stats.mux.RUnlock()
+	}
+}
+
+// tick closes the current second and returns the state of the run. It is called once a second.
+func (stats *liveStats) tick() liveSnapshot {
+	stats.mux.Lock()
+	completedSecond := stats.currentSecond
+	stats.recentSeconds = append(stats.recentSeconds, completedSecond)
+	if len(stats.recentSeconds) > liveWindowSeconds {
+		stats.recentSeconds = stats.recentSeconds[len(stats.recentSeconds)-liveWindowSeconds:]
+	}
+	stats.currentSecond = newHistogram(liveHistogramSignificantDigits)
+	recentSeconds := append([]*histogram(nil), stats.recentSeconds...)
+	stats.mux.Unlock()
+
+	window := newHistogram(liveHistogramSignificantDigits)
+	for _, second := range recentSeconds {
+		window.merge(second)
+	}
+
+	snapshot := liveSnapshot{
+		Time:              time.Now(),
+		Clients:           atomic.LoadInt64(&stats.activeClients),
+		InFlight:          atomic.LoadInt64(&stats.inFlightRequests),
+		RequestsPerSecond: atomic.SwapUint64(&stats.sentRequests, 0),
+		Percentiles:       make(map[string]float64),
+	}
+	for _, percentile := range livePercentiles {
+		snapshot.Percentiles[percentileKey(percentile)] = milliseconds(window.valueAtPercentile(percentile))
+	}
+
+	muxPhaseStatistics.Lock()
+	phase := currentPhaseStats
+	muxPhaseStatistics.Unlock()
+
+	if phase != nil {
+		snapshot.Phase = phase.name
+		if !phase.startTime.IsZero() {
+			snapshot.PhaseElapsed = snapshot.Time.Sub(phase.startTime)
+		}
+		snapshot.GetItemsErrors = phase.endpoint("/").errorsCount()
+		snapshot.BuyItemsErrors = phase.endpoint("/buy").errorsCount()
+	}
+
+	return snapshot
+}
+
+// liveFeed takes a liveSnapshot every second and hands it to every subscriber
+type liveFeed struct {
+	mux         sync.Mutex
+	subscribers map[chan liveSnapshot]bool
+	closed      bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startLiveFeed() *liveFeed {
+	feed := &liveFeed{
+		subscribers: make(map[chan liveSnapshot]bool),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go feed.run()
+	return feed
+}
+
+func (feed *liveFeed) run() {
+	defer close(feed.done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			snapshot := liveMetrics.tick()
+
+			feed.mux.Lock()
+			for subscriber := range feed.subscribers {
+				select {
+				case subscriber <- snapshot:
+				default:
+				}
+			}
+			feed.mux.Unlock()
+		case <-feed.stop:
+			return
+		}
+	}
+}
+
+// subscribe returns a channel of snapshots that is closed when the feed is closed.
+// A subscriber that is busy when a snapshot is taken misses it.
+func (feed *liveFeed) subscribe() chan liveSnapshot {
+	subscriber := make(chan liveSnapshot, 1)
+
+	feed.mux.Lock()
+	defer feed.mux.Unlock()
+
+	if feed.closed {
+		close(subscriber)
+	} else {
+		feed.subscribers[subscriber] = true
+	}
+	return subscriber
+}
+
+func (feed *liveFeed) unsubscribe(subscriber chan liveSnapshot) {
+	feed.mux.Lock()
+	defer feed.mux.Unlock()
+
+	if feed.subscribers[subscriber] {
+		delete(feed.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+func (feed *liveFeed) close() {
+	close(feed.stop)
+	<-feed.done
+
+	feed.mux.Lock()
+	defer feed.mux.Unlock()
+
+	feed.closed = true
+	for subscriber := range feed.subscribers {
+		delete(feed.subscribers, subscriber)
+		close(subscriber)
+	}
+}
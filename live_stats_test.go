@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLiveRequestsPerSecondCountsSentRequests(t *testing.T) {
+	stats := newLiveStats()
+
+	for request := 0; request < 3; request++ {
+		stats.requestStarted()
+	}
+	stats.requestFinished(time.Millisecond, true)
+
+	if snapshot := stats.tick(); snapshot.RequestsPerSecond != 3 || snapshot.InFlight != 2 {
+		t.Errorf("%d requests per second with %d in flight, expected the 3 sent requests with 2 in flight",
+			snapshot.RequestsPerSecond, snapshot.InFlight)
+	}
+
+	stats.requestFinished(time.Millisecond, true)
+	stats.requestFinished(time.Millisecond, false)
+	if snapshot := stats.tick(); snapshot.RequestsPerSecond != 0 {
+		t.Errorf("%d requests per second, expected none sent in the second", snapshot.RequestsPerSecond)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// requestMetric is one request sent to the tested server as seen by the metrics sinks.
+// A request that got no response has a negative status code.
+type requestMetric struct {
+	time        time.Time
+	phase       string
+	endpoint    string
+	encoding    string
+	statusCode  int
+	elapsedTime time.Duration
+}
+
+func (metric requestMetric) status() string {
+	if metric.statusCode <= 0 {
+		return "error"
+	}
+	return strconv.Itoa(metric.statusCode)
+}
+
+// metricsSink sends request metrics to an external monitoring system. record is called concurrently
+// by the clients and must not block, flush is called every flush interval and once more before close.
+type metricsSink interface {
+	name() string
+	record(metric requestMetric)
+	flush(flushTime time.Time) error
+	close() error
+}
+
+var (
+	metricsSinks []metricsSink
+
+	stopMetricsSinksFlush chan struct{}
+	metricsSinksFlushDone chan struct{}
+)
+
+func recordRequestMetric(metric requestMetric) {
+	for _, sink := range metricsSinks {
+		sink.record(metric)
+	}
+}
+
+func startMetricsSinks(sinks []metricsSink, flushInterval time.Duration) {
+	if len(sinks) == 0 {
+		return
+	}
+
+	metricsSinks = sinks
+	stopMetricsSinksFlush = make(chan struct{})
+	metricsSinksFlushDone = make(chan struct{})
+
+	go func() {
+		defer close(metricsSinksFlushDone)
+
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case flushTime := <-ticker.C:
+				flushMetricsSinks(flushTime)
+			case <-stopMetricsSinksFlush:
+				return
+			}
+		}
+	}()
+}
+
+func flushMetricsSinks(flushTime time.Time) {
+	for _, sink := range metricsSinks {
+		if err := sink.flush(flushTime); err != nil {
+			logError.Printf("[MAIN] Unable to send metrics to %s. Error: %s", sink.name(), err)
+		}
+	}
+}
+
+func stopMetricsSinks() {
+	if len(metricsSinks) == 0 {
+		return
+	}
+
+	close(stopMetricsSinksFlush)
+	<-metricsSinksFlushDone
+
+	flushMetricsSinks(time.Now())
+	for _, sink := range metricsSinks {
+		if err := sink.close(); err != nil {
+			logError.Printf("[MAIN] Unable to close %s. Error: %s", sink.name(), err)
+		}
+	}
+	metricsSinks = nil
+}
+
+type metricSeriesKey struct {
+	phase    string
+	endpoint string
+	encoding string
+	status   string
+}
+
+type metricSeries struct {
+	requests     uint64
+	responseTime *histogram
+}
+
+// metricsAggregator sums the requests of every series between two flushes
+type metricsAggregator struct {
+	mux    sync.Mutex
+	series map[metricSeriesKey]*metricSeries
+}
+
+func (aggregator *metricsAggregator) record(metric requestMetric) {
+	key := metricSeriesKey{phase: metric.phase, endpoint: metric.endpoint, encoding: metric.encoding, status: metric.status()}
+
+	aggregator.mux.Lock()
+	defer aggregator.mux.Unlock()
+
+	if aggregator.series == nil {
+		aggregator.series = make(map[metricSeriesKey]*metricSeries)
+	}
+
+	series, ok := aggregator.series[key]
+	if !ok {
+		series = &metricSeries{responseTime: newHistogram(clientsNumHistogramSignificantDigits)}
+		aggregator.series[key] = series
+	}
+
+	series.requests++
+	if metric.statusCode > 0 {
+		series.responseTime.record(metric.elapsedTime)
+	}
+}
+
+// take returns the series aggregated since the previous call
+func (aggregator *metricsAggregator) take() map[metricSeriesKey]*metricSeries {
+	aggregator.mux.Lock()
+	defer aggregator.mux.Unlock()
+
+	series := aggregator.series
+	aggregator.series = nil
+	return series
+}
+
+// fields returns the aggregated values of the series with response times in milliseconds
+func (series *metricSeries) fields() []metricField {
+	fields := []metricField{{name: "count", value: float64(series.requests), integer: true}}
+	if series.responseTime.count() == 0 {
+		return fields
+	}
+
+	fields = append(fields,
+		metricField{name: "min_ms", value: milliseconds(series.responseTime.min())},
+		metricField{name: "mean_ms", value: milliseconds(series.responseTime.mean())},
+		metricField{name: "max_ms", value: milliseconds(series.responseTime.max())})
+	for _, percentile := range reportPercentiles {
+		fields = append(fields, metricField{
+			name:  percentileKey(percentile) + "_ms",
+			value: milliseconds(series.responseTime.valueAtPercentile(percentile)),
+		})
+	}
+	return fields
+}
+
+type metricField struct {
+	name    string
+	value   float64
+	integer bool
+}
+
+// format writes the value rounded to microseconds, the precision of the response time histograms
+func (field metricField) format() string {
+	if field.integer {
+		return strconv.FormatInt(int64(field.value), 10)
+	}
+	return strconv.FormatFloat(math.Round(field.value*1000)/1000, 'f', -1, 64)
+}
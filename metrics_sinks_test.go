@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testFlushTime = time.Unix(1700000000, 123456789)
+
+// recordTestMetrics records requests whose median is reported as the highest value of its bucket,
+// 2.007 ms with the two significant digits of the series histograms
+func recordTestMetrics(sink metricsSink) {
+	sink.record(requestMetric{phase: "Ramp up", endpoint: "/", encoding: "json", statusCode: 200,
+		elapsedTime: 2 * time.Millisecond})
+	sink.record(requestMetric{phase: "Ramp up", endpoint: "/", encoding: "json", statusCode: 200,
+		elapsedTime: 4 * time.Millisecond})
+	sink.record(requestMetric{phase: "Ramp up", endpoint: "/buy", encoding: "json", statusCode: -1,
+		elapsedTime: time.Millisecond})
+}
+
+func checkLines(t *testing.T, actual, expected []string) {
+	if len(actual) != len(expected) {
+		t.Fatalf("received %d lines, expected %d:\n%s", len(actual), len(expected), strings.Join(actual, "\n"))
+	}
+	for index := range expected {
+		if actual[index] != expected[index] {
+			t.Errorf("line %d is\n%s\nexpected\n%s", index+1, actual[index], expected[index])
+		}
+	}
+}
+
+func TestInfluxSinkSendsLineProtocolOverUdp(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink, err := newInfluxSink("udp://" + listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.close()
+
+	recordTestMetrics(sink)
+	if err := sink.flush(testFlushTime); err != nil {
+		t.Fatal(err)
+	}
+
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	datagram := make([]byte, influxMaxDatagramBytes)
+	size, _, err := listener.ReadFrom(datagram)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLines(t, strings.Split(strings.TrimSuffix(string(datagram[:size]), "\n"), "\n"), []string{
+		`load_generator_requests,endpoint=/,encoding=json,phase=Ramp\ up,status=200 count=2i,min_ms=2,mean_ms=3,` +
+			`max_ms=4,p50_ms=2.007,p90_ms=4,p95_ms=4,p99_ms=4,p99.9_ms=4 1700000000123456789`,
+		`load_generator_requests,endpoint=/buy,encoding=json,phase=Ramp\ up,status=error count=1i 1700000000123456789`,
+	})
+
+	if err := sink.flush(testFlushTime); err != nil {
+		t.Fatal(err)
+	}
+	listener.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if size, _, err := listener.ReadFrom(datagram); err == nil {
+		t.Errorf("a flush without new requests sent %q", datagram[:size])
+	}
+}
+
+func TestGraphiteSinkSendsPlaintextOverTcp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	sink := newGraphiteSink(listener.Addr().String(), "load_generator.")
+	recordTestMetrics(sink)
+	if err := sink.flush(testFlushTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case lines := <-received:
+		checkLines(t, lines, []string{
+			"load_generator.Ramp_up.buy.json.error.count 1 1700000000",
+			"load_generator.Ramp_up.root.json.200.count 2 1700000000",
+			"load_generator.Ramp_up.root.json.200.max_ms 4 1700000000",
+			"load_generator.Ramp_up.root.json.200.mean_ms 3 1700000000",
+			"load_generator.Ramp_up.root.json.200.min_ms 2 1700000000",
+			"load_generator.Ramp_up.root.json.200.p50_ms 2.007 1700000000",
+			"load_generator.Ramp_up.root.json.200.p90_ms 4 1700000000",
+			"load_generator.Ramp_up.root.json.200.p95_ms 4 1700000000",
+			"load_generator.Ramp_up.root.json.200.p99_9_ms 4 1700000000",
+			"load_generator.Ramp_up.root.json.200.p99_ms 4 1700000000",
+		})
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Graphite listener received nothing")
+	}
+}
+
+func receiveStatsdLines(t *testing.T, dogStatsd bool) []string {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink, err := newStatsdSink(listener.LocalAddr().String(), "load_generator", dogStatsd, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.close()
+
+	recordTestMetrics(sink)
+	sink.record(requestMetric{phase: "Ramp up", endpoint: "/", encoding: "json", statusCode: 200,
+		elapsedTime: 2 * time.Millisecond})
+	if err := sink.flush(testFlushTime); err != nil {
+		t.Fatal(err)
+	}
+
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	packet := make([]byte, statsdMaxPacketBytes)
+	size, _, err := listener.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(string(packet[:size]), "\n")
+}
+
+func TestStatsdSinkSendsAggregatedTimers(t *testing.T) {
+	checkLines(t, receiveStatsdLines(t, false), []string{
+		"load_generator.requests.Ramp_up.root.json.200:3|c",
+		"load_generator.response_time.Ramp_up.root.json.200:2|ms",
+		"load_generator.response_time.Ramp_up.root.json.200:2|ms",
+		"load_generator.response_time.Ramp_up.root.json.200:4|ms",
+		"load_generator.requests.Ramp_up.buy.json.error:1|c",
+	})
+}
+
+func TestDogStatsdSinkSendsMultiValueTimers(t *testing.T) {
+	checkLines(t, receiveStatsdLines(t, true), []string{
+		"load_generator.requests:3|c|#endpoint:/,content_type:json,status:200,phase:Ramp up",
+		"load_generator.response_time:2:2:4|ms|#endpoint:/,content_type:json,status:200,phase:Ramp up",
+		"load_generator.requests:1|c|#endpoint:/buy,content_type:json,status:error,phase:Ramp up",
+	})
+}
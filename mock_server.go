@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mockShop implements the contract of getExpectedGetItemsResponse and getExpectedBuyItemsResponse
+// with an artificial latency and injected errors
+type mockShop struct {
+	latency distribution
+
+	errorRate     float64
+	wrongBodyRate float64
+	resetRate     float64
+
+	random    *rand.Rand
+	muxRandom sync.Mutex
+}
+
+func serveMockCommand(arguments []string) error {
+	flags := newFlagSet("serve-mock", "")
+	listenAddress := flags.String("listen", ":8080", "address to serve the mock shop on")
+	latency := flags.String("latency", "0s",
+		"response latency distribution: a duration, constant:D, uniform:MIN,MAX, normal:MEAN,STDDEV, exponential:MEAN, "+
+			"lognormal:MEAN,STDDEV or empirical:HISTOGRAM_FILE")
+	errorRate := flags.Float64("error-rate", 0, "fraction of requests answered with 500 Internal Server Error")
+	wrongBodyRate := flags.Float64("wrong-body-rate", 0, "fraction of requests answered with an unexpected body")
+	resetRate := flags.Float64("reset-rate", 0, "fraction of requests whose connection is closed without a response")
+	seed := flags.Int64("seed", 0, "seed of the random generator, 0 picks a random seed")
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	latencyDistribution, err := parseDistribution(*latency)
+	if err != nil {
+		return err
+	}
+	if err := latencyDistribution.loadHistogram(""); err != nil {
+		return err
+	}
+
+	for name, rate := range map[string]float64{"error-rate": *errorRate, "wrong-body-rate": *wrongBodyRate, "reset-rate": *resetRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("-%s must be between 0 and 1, got %g", name, rate)
+		}
+	}
+	if *errorRate+*wrongBodyRate+*resetRate > 1 {
+		return errors.New("the sum of -error-rate, -wrong-body-rate and -reset-rate must not exceed 1")
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	shop := &mockShop{
+		latency:       latencyDistribution,
+		errorRate:     *errorRate,
+		wrongBodyRate: *wrongBodyRate,
+		resetRate:     *resetRate,
+		random:        rand.New(rand.NewSource(*seed)),
+	}
+
+	logStat.Printf("[MOCK] Serving the mock shop on %s with latency %s, error rate %g, wrong body rate %g, "+
+		"reset rate %g and random seed %d", *listenAddress, latencyDistribution, *errorRate, *wrongBodyRate, *resetRate, *seed)
+	return http.ListenAndServe(*listenAddress, shop.serveMux())
+}
+
+func (shop *mockShop) serveMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	getItems := shop.handle(getExpectedGetItemsResponse)
+	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+		// the / pattern matches every path, the other paths are not a part of the shop
+		if request.URL.Path != "/" {
+			http.NotFound(writer, request)
+			return
+		}
+		getItems(writer, request)
+	})
+	mux.HandleFunc("/buy", shop.handle(getExpectedBuyItemsResponse))
+	return mux
+}
+
+// requestName returns the name passed in the name query parameter or in the JSON of the json form field
+func requestName(request *http.Request) string {
+	if name := request.URL.Query().Get("name"); name != "" {
+		return name
+	}
+
+	if request.Method != "POST" {
+		return ""
+	}
+
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data") {
+		request.ParseMultipartForm(1 << 20)
+	} else {
+		request.ParseForm()
+	}
+
+	var item Item
+	json.Unmarshal([]byte(request.PostFormValue("json")), &item)
+	return item.Name
+}
+
+func (shop *mockShop) decide() (delay time.Duration, outcome float64) {
+	shop.muxRandom.Lock()
+	defer shop.muxRandom.Unlock()
+
+	return shop.latency.sample(shop.random), shop.random.Float64()
+}
+
+func (shop *mockShop) handle(expectedResponse func(name string) string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		name := requestName(request)
+		delay, outcome := shop.decide()
+
+		time.Sleep(delay)
+
+		switch {
+		case outcome < shop.resetRate:
+			if hijacker, ok := writer.(http.Hijacker); ok {
+				if connection, _, err := hijacker.Hijack(); err == nil {
+					connection.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		case outcome < shop.resetRate+shop.errorRate:
+			http.Error(writer, "injected error", http.StatusInternalServerError)
+		case outcome < shop.resetRate+shop.errorRate+shop.wrongBodyRate:
+			writer.Write([]byte(`{"result":"injected"}`))
+		default:
+			logInfo.Printf("[MOCK] %s %s for %q", request.Method, request.URL.Path, name)
+			writer.Write([]byte(expectedResponse(name)))
+		}
+	}
+}
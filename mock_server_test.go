@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestMockShop(t *testing.T, shop *mockShop) string {
+	if err := openLogs(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(closeLogs)
+
+	shop.latency = distribution{kind: distributionConstant, params: []time.Duration{0}}
+	shop.random = rand.New(rand.NewSource(1))
+	server := httptest.NewServer(shop.serveMux())
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestMockShopServesTheExpectedResponses(t *testing.T) {
+	shopUrl := startTestMockShop(t, &mockShop{})
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		expected           string
+	}{
+		{method: "GET", path: "/?name=ticketbright", status: http.StatusOK,
+			expected: getExpectedGetItemsResponse("ticketbright")},
+		{method: "GET", path: "/", status: http.StatusOK, expected: getExpectedGetItemsResponse("")},
+		{method: "POST", path: "/buy", body: url.Values{"json": {`{"name":"tea"}`}}.Encode(), status: http.StatusOK,
+			expected: getExpectedBuyItemsResponse("tea")},
+		{method: "GET", path: "/buy?name=coffee", status: http.StatusOK, expected: getExpectedBuyItemsResponse("coffee")},
+		{method: "GET", path: "/cart?name=ticketbright", status: http.StatusNotFound},
+		{method: "GET", path: "/buy/tea", status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		request, err := http.NewRequest(test.method, shopUrl+test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.StatusCode != test.status {
+			t.Errorf("%s %s answered %d, expected %d", test.method, test.path, response.StatusCode, test.status)
+		} else if test.expected != "" && string(body) != test.expected {
+			t.Errorf("%s %s answered %s, expected %s", test.method, test.path, body, test.expected)
+		}
+	}
+}
+
+func TestMockShopInjectsFailuresAtTheConfiguredRates(t *testing.T) {
+	shop := &mockShop{errorRate: 0.2, wrongBodyRate: 0.1, resetRate: 0.05}
+	shopUrl := startTestMockShop(t, shop)
+
+	// every request on a new connection, so a reset request is not retried on another one
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	const requestsNum = 1000
+	outcomes := make(map[string]int)
+	for requestIndex := 0; requestIndex < requestsNum; requestIndex++ {
+		response, err := client.Get(shopUrl + "/?name=ticketbright")
+		if err != nil {
+			outcomes["reset"]++
+			continue
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		switch {
+		case err != nil:
+			outcomes["reset"]++
+		case response.StatusCode == http.StatusInternalServerError:
+			outcomes["error"]++
+		case string(body) != getExpectedGetItemsResponse("ticketbright"):
+			outcomes["wrong body"]++
+		default:
+			outcomes["valid"]++
+		}
+	}
+
+	for outcome, rate := range map[string]float64{"reset": shop.resetRate, "error": shop.errorRate,
+		"wrong body": shop.wrongBodyRate, "valid": 1 - shop.resetRate - shop.errorRate - shop.wrongBodyRate} {
+		if actualRate := float64(outcomes[outcome]) / requestsNum; math.Abs(actualRate-rate) > 0.03 {
+			t.Errorf("%s rate is %g, expected %g", outcome, actualRate, rate)
+		}
+	}
+}
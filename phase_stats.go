@@ -0,0 +1,353 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// testedEndpoints always have statistics, the endpoints journey steps declare get theirs on first use
+var testedEndpoints = []string{"/", "/buy"}
+
+// timeSeries counts events per second since its start time
+type timeSeries struct {
+	mux       sync.RWMutex
+	startTime time.Time
+	counts    []uint64
+}
+
+func newTimeSeries(startTime time.Time) *timeSeries {
+	return &timeSeries{startTime: startTime.Truncate(time.Second)}
+}
+
+func (series *timeSeries) add(eventTime time.Time, count uint64) {
+	index := int(eventTime.Sub(series.startTime) / time.Second)
+	if index < 0 {
+		index = 0
+	}
+
+	series.mux.RLock()
+	if index < len(series.counts) {
+		atomic.AddUint64(&series.counts[index], count)
+		series.mux.RUnlock()
+		return
+	}
+	series.mux.RUnlock()
+
+	series.mux.Lock()
+	if index >= len(series.counts) {
+		grownCounts := make([]uint64, index+1, 2*(index+1))
+		copy(grownCounts, series.counts)
+		series.counts = grownCounts
+	}
+	series.counts[index] += count
+	series.mux.Unlock()
+}
+
+func (series *timeSeries) values() []uint64 {
+	series.mux.Lock()
+	defer series.mux.Unlock()
+
+	return append([]uint64(nil), series.counts...)
+}
+
+func (series *timeSeries) merge(other *timeSeries) {
+	for index, count := range other.values() {
+		if count > 0 {
+			series.add(other.startTime.Add(time.Duration(index)*time.Second), count)
+		}
+	}
+}
+
+// clientsNumHistograms keeps a response time histogram for every number of clients met during a phase
+type clientsNumHistograms struct {
+	mux        sync.RWMutex
+	histograms map[int]*histogram
+}
+
+func newClientsNumHistograms() *clientsNumHistograms {
+	return &clientsNumHistograms{histograms: make(map[int]*histogram)}
+}
+
+func (levels *clientsNumHistograms) get(clientsNum int) *histogram {
+	levels.mux.RLock()
+	levelHistogram, ok := levels.histograms[clientsNum]
+	levels.mux.RUnlock()
+	if ok {
+		return levelHistogram
+	}
+
+	levels.mux.Lock()
+	defer levels.mux.Unlock()
+
+	if levelHistogram, ok = levels.histograms[clientsNum]; !ok {
+		levelHistogram = newHistogram(clientsNumHistogramSignificantDigits)
+		levels.histograms[clientsNum] = levelHistogram
+	}
+	return levelHistogram
+}
+
+func (levels *clientsNumHistograms) clientsNums() []int {
+	levels.mux.RLock()
+	defer levels.mux.RUnlock()
+
+	clientsNums := make([]int, 0, len(levels.histograms))
+	for clientsNum := range levels.histograms {
+		clientsNums = append(clientsNums, clientsNum)
+	}
+	sort.Ints(clientsNums)
+	return clientsNums
+}
+
+func (levels *clientsNumHistograms) merge(other *clientsNumHistograms) {
+	for _, clientsNum := range other.clientsNums() {
+		levels.get(clientsNum).merge(other.get(clientsNum))
+	}
+}
+
+type endpointStats struct {
+	responseTime           *histogram
+	correctedResponseTime  *histogram
+	clientsNumResponseTime *clientsNumHistograms
+	requestsNum            *timeSeries
+	errorsNum              *timeSeries
+	connection             *connectionStats
+
+	bytesSent     uint64
+	bytesReceived uint64
+
+	// The errors are kept per class, and per message with its details removed, so a failing server
+	// does not make the memory use grow with every error
+	errorClassesStats map[string]*errorClassStats
+	errorBreakdown    map[string]int
+	errorsRandom      *rand.Rand
+	muxErrors         sync.Mutex
+}
+
+func newEndpointStats(startTime time.Time) *endpointStats {
+	return &endpointStats{
+		responseTime:           newHistogram(histogramSignificantDigits),
+		correctedResponseTime:  newHistogram(histogramSignificantDigits),
+		clientsNumResponseTime: newClientsNumHistograms(),
+		requestsNum:            newTimeSeries(startTime),
+		errorsNum:              newTimeSeries(startTime),
+		connection:             newConnectionStats(),
+		errorClassesStats:      make(map[string]*errorClassStats),
+		errorBreakdown:         make(map[string]int),
+		errorsRandom:           rand.New(rand.NewSource(startTime.UnixNano())),
+	}
+}
+
+func (stats *endpointStats) merge(other *endpointStats) {
+	stats.responseTime.merge(other.responseTime)
+	stats.correctedResponseTime.merge(other.correctedResponseTime)
+	stats.clientsNumResponseTime.merge(other.clientsNumResponseTime)
+	stats.requestsNum.merge(other.requestsNum)
+	stats.errorsNum.merge(other.errorsNum)
+	stats.connection.merge(other.connection)
+	atomic.AddUint64(&stats.bytesSent, atomic.LoadUint64(&other.bytesSent))
+	atomic.AddUint64(&stats.bytesReceived, atomic.LoadUint64(&other.bytesReceived))
+
+	other.muxErrors.Lock()
+	otherClasses := make(map[string]*errorClassStats)
+	for name, class := range other.errorClassesStats {
+		otherClasses[name] = class.copy()
+	}
+	otherBreakdown := make(map[string]int)
+	for key, count := range other.errorBreakdown {
+		otherBreakdown[key] = count
+	}
+	other.muxErrors.Unlock()
+
+	stats.muxErrors.Lock()
+	defer stats.muxErrors.Unlock()
+
+	for name, otherClass := range otherClasses {
+		class, ok := stats.errorClassesStats[name]
+		if !ok {
+			class = newErrorClassStats(stats.errorsNum.startTime)
+			stats.errorClassesStats[name] = class
+		}
+		class.merge(otherClass, stats.errorsRandom)
+	}
+	for key, count := range otherBreakdown {
+		stats.errorBreakdown[key] += count
+	}
+}
+
+func (stats *endpointStats) recordError(errResponse ErrResponse) {
+	stats.muxErrors.Lock()
+	class, ok := stats.errorClassesStats[errResponse.class]
+	if !ok {
+		class = newErrorClassStats(stats.errorsNum.startTime)
+		stats.errorClassesStats[errResponse.class] = class
+	}
+	class.record(errResponse, stats.errorsRandom)
+	stats.errorBreakdown[errorBreakdownKey(errResponse.message)]++
+	stats.muxErrors.Unlock()
+
+	stats.errorsNum.add(errResponse.time, 1)
+}
+
+func (stats *endpointStats) errorsCount() int {
+	stats.muxErrors.Lock()
+	defer stats.muxErrors.Unlock()
+
+	var count int
+	for _, class := range stats.errorClassesStats {
+		count += class.count
+	}
+	return count
+}
+
+// phaseStats collects the statistics of one scenario phase in constant memory
+type phaseStats struct {
+	name      string
+	startTime time.Time
+	endTime   time.Time
+	showStat  bool
+
+	sentRequestsCount      uint32
+	droppedIterationsCount uint32
+
+	endpoints    map[string]*endpointStats
+	muxEndpoints sync.RWMutex
+
+	journeys            map[string]*journeyStats
+	userStates          map[string]*journeyStats
+	userStateDwellTimes map[string]*histogram
+	muxJourneys         sync.Mutex
+
+	// version changes with every recorded response, error and merge, the merged view of all the endpoints
+	// is only rebuilt when it does
+	version                  uint64
+	allEndpointsStats        *endpointStats
+	allEndpointsStatsVersion uint64
+	muxAllEndpoints          sync.Mutex
+}
+
+var (
+	currentPhaseStats  *phaseStats
+	phaseStatsHistory  []*phaseStats
+	muxPhaseStatistics = &sync.Mutex{}
+)
+
+func newPhaseStats(name string, startTime time.Time) *phaseStats {
+	stats := &phaseStats{name: name, startTime: startTime, endpoints: make(map[string]*endpointStats),
+		journeys: make(map[string]*journeyStats), userStates: make(map[string]*journeyStats),
+		userStateDwellTimes: make(map[string]*histogram)}
+	for _, endpoint := range testedEndpoints {
+		stats.endpoints[endpoint] = newEndpointStats(startTime)
+	}
+	return stats
+}
+
+func startPhaseStats(name string, startTime time.Time) *phaseStats {
+	muxPhaseStatistics.Lock()
+	defer muxPhaseStatistics.Unlock()
+
+	currentPhaseStats = newPhaseStats(name, startTime)
+	phaseStatsHistory = append(phaseStatsHistory, currentPhaseStats)
+	return currentPhaseStats
+}
+
+// endpoint returns the statistics of an endpoint, creating them when the endpoint is met for the first time
+func (stats *phaseStats) endpoint(resource string) *endpointStats {
+	stats.muxEndpoints.RLock()
+	endpoint, ok := stats.endpoints[resource]
+	stats.muxEndpoints.RUnlock()
+	if ok {
+		return endpoint
+	}
+
+	stats.muxEndpoints.Lock()
+	defer stats.muxEndpoints.Unlock()
+
+	if endpoint, ok = stats.endpoints[resource]; !ok {
+		endpoint = newEndpointStats(stats.startTime)
+		stats.endpoints[resource] = endpoint
+	}
+	return endpoint
+}
+
+// endpointNames lists the tested endpoints first and then the other endpoints in alphabetical order
+func (stats *phaseStats) endpointNames() []string {
+	stats.muxEndpoints.RLock()
+	defer stats.muxEndpoints.RUnlock()
+
+	var otherEndpoints []string
+	for endpoint := range stats.endpoints {
+		if endpoint != "/" && endpoint != "/buy" {
+			otherEndpoints = append(otherEndpoints, endpoint)
+		}
+	}
+	sort.Strings(otherEndpoints)
+
+	return append(append([]string(nil), testedEndpoints...), otherEndpoints...)
+}
+
+func (stats *phaseStats) recordResponseTime(resource string, responseTime ResponseTime) {
+	endpoint := stats.endpoint(resource)
+
+	endpoint.responseTime.record(responseTime.elapsedTime)
+	endpoint.correctedResponseTime.recordWithExpectedInterval(
+		responseTime.correctedElapsedTime(), responseTime.expectedInterval)
+	endpoint.clientsNumResponseTime.get(responseTime.clientsNum).record(responseTime.elapsedTime)
+	endpoint.requestsNum.add(responseTime.timeWhileSendingRequest, 1)
+	endpoint.connection.record(responseTime.connection)
+	atomic.AddUint64(&endpoint.bytesSent, uint64(responseTime.bytesSent))
+	atomic.AddUint64(&endpoint.bytesReceived, uint64(responseTime.bytesReceived))
+
+	// the version changes once the data is recorded, a merge of the older version must not be cached as the new one
+	atomic.AddUint64(&stats.version, 1)
+}
+
+func (stats *phaseStats) recordError(resource string, errResponse ErrResponse) {
+	stats.endpoint(resource).recordError(errResponse)
+	atomic.AddUint64(&stats.version, 1)
+}
+
+// duration is the time the phase took, zero while it is still running
+func (stats *phaseStats) duration() time.Duration {
+	if stats.endTime.Before(stats.startTime) {
+		return 0
+	}
+	return stats.endTime.Sub(stats.startTime)
+}
+
+// allEndpoints merges the statistics of every endpoint of the phase. The merged view is cached until
+// something is recorded, so the callers must not change it.
+func (stats *phaseStats) allEndpoints() *endpointStats {
+	stats.muxAllEndpoints.Lock()
+	defer stats.muxAllEndpoints.Unlock()
+
+	version := atomic.LoadUint64(&stats.version)
+	if stats.allEndpointsStats != nil && stats.allEndpointsStatsVersion == version {
+		return stats.allEndpointsStats
+	}
+
+	allEndpointsStats := newEndpointStats(stats.startTime)
+	for _, endpoint := range stats.endpointNames() {
+		allEndpointsStats.merge(stats.endpoint(endpoint))
+	}
+	stats.allEndpointsStats, stats.allEndpointsStatsVersion = allEndpointsStats, version
+	return allEndpointsStats
+}
+
+func (stats *phaseStats) merge(other *phaseStats) {
+	atomic.AddUint32(&stats.sentRequestsCount, atomic.LoadUint32(&other.sentRequestsCount))
+	atomic.AddUint32(&stats.droppedIterationsCount, atomic.LoadUint32(&other.droppedIterationsCount))
+
+	for _, endpoint := range other.endpointNames() {
+		stats.endpoint(endpoint).merge(other.endpoint(endpoint))
+	}
+	atomic.AddUint64(&stats.version, 1)
+
+	stats.mergeJourneys(other)
+
+	if other.endTime.After(stats.endTime) {
+		stats.endTime = other.endTime
+	}
+}
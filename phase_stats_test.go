@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAllEndpointsIsNotCachedBeforeTheDataIsRecorded(t *testing.T) {
+	startTime := time.Now()
+	stats := newPhaseStats("test", startTime)
+
+	// the records race with the merges of all the endpoints, a merge cached before the data is recorded
+	// would miss the last records of a round
+	const rounds, writers, recordsPerWriter = 50, 4, 20
+	for round := 1; round <= rounds; round++ {
+		wg := &sync.WaitGroup{}
+		for writer := 0; writer < writers; writer++ {
+			wg.Add(1)
+			go func(resource string) {
+				defer wg.Done()
+				for record := 0; record < recordsPerWriter; record++ {
+					stats.recordResponseTime(resource, ResponseTime{elapsedTime: time.Millisecond,
+						timeWhileSendingRequest: startTime, intendedSendTime: startTime})
+					stats.recordError(resource, ErrResponse{time: startTime, class: errorClassTimeout, message: "timeout"})
+				}
+			}([]string{"/", "/buy"}[writer%2])
+		}
+
+		recorded := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(recorded)
+		}()
+		for waiting := true; waiting; {
+			select {
+			case <-recorded:
+				waiting = false
+			default:
+				stats.allEndpoints()
+			}
+		}
+
+		var responses uint64
+		var errors int
+		for _, resource := range stats.endpointNames() {
+			responses += stats.endpoint(resource).responseTime.count()
+			errors += stats.endpoint(resource).errorsCount()
+		}
+		expected := round * writers * recordsPerWriter
+		allEndpoints := stats.allEndpoints()
+		if count := allEndpoints.responseTime.count(); count != responses || count != uint64(expected) {
+			t.Fatalf("round %d: all endpoints have %d responses, the endpoints have %d", round, count, responses)
+		}
+		if count := allEndpoints.errorsCount(); count != errors || count != expected {
+			t.Fatalf("round %d: all endpoints have %d errors, the endpoints have %d", round, count, errors)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var prometheusLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestCounterKey struct {
+	endpoint string
+	status   string
+	encoding string
+}
+
+// latencyBuckets counts the response times of every bucket on its own, the last count being the responses
+// slower than every bound. The cumulative buckets, +Inf and the count are summed from the same loaded
+// counts when written, so a scrape racing with a request never shows a bucket above the total.
+type latencyBuckets struct {
+	counts         []uint64
+	sumNanoseconds uint64
+}
+
+// generatorMetrics keeps the counters of the whole run for the Prometheus /metrics endpoint
+type generatorMetrics struct {
+	mux          sync.RWMutex
+	requests     map[requestCounterKey]*uint64
+	responseTime map[string]*latencyBuckets
+}
+
+var runMetrics = &generatorMetrics{
+	requests:     make(map[requestCounterKey]*uint64),
+	responseTime: make(map[string]*latencyBuckets),
+}
+
+func requestEncoding(body, contentType string) string {
+	if body == "" {
+		return "query"
+	}
+	switch contentType {
+	case "application/x-www-form-urlencoded":
+		return "urlencoded"
+	case "multipart/form-data":
+		return "multipart"
+	}
+	return "other"
+}
+
+func (metrics *generatorMetrics) recordRequest(metric requestMetric) {
+	endpoint := metric.endpoint
+	key := requestCounterKey{endpoint: endpoint, status: metric.status(), encoding: metric.encoding}
+
+	metrics.mux.RLock()
+	counter, counterExists := metrics.requests[key]
+	buckets, bucketsExist := metrics.responseTime[endpoint]
+	metrics.mux.RUnlock()
+
+	if !counterExists || !bucketsExist {
+		metrics.mux.Lock()
+		if counter, counterExists = metrics.requests[key]; !counterExists {
+			counter = new(uint64)
+			metrics.requests[key] = counter
+		}
+		if buckets, bucketsExist = metrics.responseTime[endpoint]; !bucketsExist {
+			buckets = &latencyBuckets{counts: make([]uint64, len(prometheusLatencyBuckets)+1)}
+			metrics.responseTime[endpoint] = buckets
+		}
+		metrics.mux.Unlock()
+	}
+
+	atomic.AddUint64(counter, 1)
+
+	if metric.statusCode <= 0 {
+		return
+	}
+
+	bucketIndex := sort.SearchFloat64s(prometheusLatencyBuckets, metric.elapsedTime.Seconds())
+	atomic.AddUint64(&buckets.counts[bucketIndex], 1)
+	atomic.AddUint64(&buckets.sumNanoseconds, uint64(metric.elapsedTime))
+}
+
+func prometheusLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatPrometheusFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func (metrics *generatorMetrics) write(output io.Writer) {
+	metrics.mux.RLock()
+	requests := make(map[requestCounterKey]*uint64, len(metrics.requests))
+	requestKeys := make([]requestCounterKey, 0, len(metrics.requests))
+	for key, counter := range metrics.requests {
+		requests[key] = counter
+		requestKeys = append(requestKeys, key)
+	}
+	responseTime := make(map[string]*latencyBuckets, len(metrics.responseTime))
+	endpoints := make([]string, 0, len(metrics.responseTime))
+	for endpoint, buckets := range metrics.responseTime {
+		responseTime[endpoint] = buckets
+		endpoints = append(endpoints, endpoint)
+	}
+	metrics.mux.RUnlock()
+
+	sort.Slice(requestKeys, func(i, j int) bool {
+		if requestKeys[i].endpoint != requestKeys[j].endpoint {
+			return requestKeys[i].endpoint < requestKeys[j].endpoint
+		}
+		if requestKeys[i].status != requestKeys[j].status {
+			return requestKeys[i].status < requestKeys[j].status
+		}
+		return requestKeys[i].encoding < requestKeys[j].encoding
+	})
+	sort.Strings(endpoints)
+
+	fmt.Fprintln(output, "# HELP load_generator_requests_total Requests sent to the tested server by endpoint, status and request encoding.")
+	fmt.Fprintln(output, "# TYPE load_generator_requests_total counter")
+	for _, key := range requestKeys {
+		counter := requests[key]
+		fmt.Fprintf(output, "load_generator_requests_total{endpoint=\"%s\",status=\"%s\",encoding=\"%s\"} %d\n",
+			prometheusLabelValue(key.endpoint), prometheusLabelValue(key.status), prometheusLabelValue(key.encoding),
+			atomic.LoadUint64(counter))
+	}
+
+	fmt.Fprintln(output, "# HELP load_generator_response_time_seconds Response time of the tested server by endpoint.")
+	fmt.Fprintln(output, "# TYPE load_generator_response_time_seconds histogram")
+	for _, endpoint := range endpoints {
+		buckets := responseTime[endpoint]
+		endpointLabel := prometheusLabelValue(endpoint)
+		var count uint64
+		for index, upperBound := range prometheusLatencyBuckets {
+			count += atomic.LoadUint64(&buckets.counts[index])
+			fmt.Fprintf(output, "load_generator_response_time_seconds_bucket{endpoint=\"%s\",le=\"%s\"} %d\n",
+				endpointLabel, formatPrometheusFloat(upperBound), count)
+		}
+		count += atomic.LoadUint64(&buckets.counts[len(prometheusLatencyBuckets)])
+		fmt.Fprintf(output, "load_generator_response_time_seconds_bucket{endpoint=\"%s\",le=\"+Inf\"} %d\n", endpointLabel, count)
+		fmt.Fprintf(output, "load_generator_response_time_seconds_sum{endpoint=\"%s\"} %s\n", endpointLabel,
+			formatPrometheusFloat(time.Duration(atomic.LoadUint64(&buckets.sumNanoseconds)).Seconds()))
+		fmt.Fprintf(output, "load_generator_response_time_seconds_count{endpoint=\"%s\"} %d\n", endpointLabel, count)
+	}
+
+	var sentRequests, droppedIterations uint64
+	validationErrors := make(map[string]map[string]int)
+	var errorEndpoints []string
+
+	muxPhaseStatistics.Lock()
+	for _, stats := range phaseStatsHistory {
+		sentRequests += uint64(atomic.LoadUint32(&stats.sentRequestsCount))
+		droppedIterations += uint64(atomic.LoadUint32(&stats.droppedIterationsCount))
+		for _, endpoint := range stats.endpointNames() {
+			if validationErrors[endpoint] == nil {
+				validationErrors[endpoint] = make(map[string]int)
+				errorEndpoints = append(errorEndpoints, endpoint)
+			}
+			for class, count := range stats.endpoint(endpoint).errorClassCounts() {
+				validationErrors[endpoint][class] += count
+			}
+		}
+	}
+	muxPhaseStatistics.Unlock()
+	sort.Strings(errorEndpoints)
+
+	fmt.Fprintln(output, "# HELP load_generator_messages_total Client messages sent, counting every get items and buy items request.")
+	fmt.Fprintln(output, "# TYPE load_generator_messages_total counter")
+	fmt.Fprintf(output, "load_generator_messages_total %d\n", sentRequests)
+
+	fmt.Fprintln(output, "# HELP load_generator_errors_total Invalid responses by endpoint and error class, including failed requests.")
+	fmt.Fprintln(output, "# TYPE load_generator_errors_total counter")
+	for _, endpoint := range errorEndpoints {
+		classes := make([]string, 0, len(validationErrors[endpoint]))
+		for class := range validationErrors[endpoint] {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+
+		for _, class := range classes {
+			fmt.Fprintf(output, "load_generator_errors_total{endpoint=\"%s\",class=\"%s\"} %d\n",
+				prometheusLabelValue(endpoint), prometheusLabelValue(class), validationErrors[endpoint][class])
+		}
+	}
+
+	fmt.Fprintln(output, "# HELP load_generator_dropped_iterations_total Arrival-rate iterations dropped because all virtual users were busy.")
+	fmt.Fprintln(output, "# TYPE load_generator_dropped_iterations_total counter")
+	fmt.Fprintf(output, "load_generator_dropped_iterations_total %d\n", droppedIterations)
+
+	fmt.Fprintln(output, "# HELP load_generator_active_clients Virtual clients running now.")
+	fmt.Fprintln(output, "# TYPE load_generator_active_clients gauge")
+	fmt.Fprintf(output, "load_generator_active_clients %d\n", atomic.LoadInt64(&liveMetrics.activeClients))
+
+	fmt.Fprintln(output, "# HELP load_generator_in_flight_requests Requests waiting for a response now.")
+	fmt.Fprintln(output, "# TYPE load_generator_in_flight_requests gauge")
+	fmt.Fprintf(output, "load_generator_in_flight_requests %d\n", atomic.LoadInt64(&liveMetrics.inFlightRequests))
+}
+
+func serveMetrics(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	runMetrics.write(writer)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusHistogramBucketsAreCumulative(t *testing.T) {
+	metrics := &generatorMetrics{requests: make(map[requestCounterKey]*uint64), responseTime: make(map[string]*latencyBuckets)}
+	for _, elapsedTime := range []time.Duration{500 * time.Microsecond, time.Millisecond, 3 * time.Millisecond, 20 * time.Second} {
+		metrics.recordRequest(requestMetric{endpoint: "/", encoding: "query", statusCode: 200, elapsedTime: elapsedTime})
+	}
+
+	output := &bytes.Buffer{}
+	metrics.write(output)
+
+	for _, line := range []string{
+		`load_generator_response_time_seconds_bucket{endpoint="/",le="0.001"} 2`,
+		`load_generator_response_time_seconds_bucket{endpoint="/",le="0.0025"} 2`,
+		`load_generator_response_time_seconds_bucket{endpoint="/",le="0.005"} 3`,
+		`load_generator_response_time_seconds_bucket{endpoint="/",le="10"} 3`,
+		`load_generator_response_time_seconds_bucket{endpoint="/",le="+Inf"} 4`,
+		`load_generator_response_time_seconds_count{endpoint="/"} 4`,
+	} {
+		if !strings.Contains(output.String(), line+"\n") {
+			t.Errorf("the metrics have no line %s:\n%s", line, output.String())
+		}
+	}
+}
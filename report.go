@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// runReport is the machine-readable result of a run. Latencies are in milliseconds.
+type runReport struct {
+	Metadata runMetadata   `json:"metadata"`
+	Phases   []phaseReport `json:"phases"`
+}
+
+type runMetadata struct {
+	Command      string    `json:"command"`
+	TargetUrl    string    `json:"targetUrl,omitempty"`
+	SamplesFile  string    `json:"samplesFile,omitempty"`
+	ScenarioFile string    `json:"scenarioFile,omitempty"`
+	Scenario     *Scenario `json:"scenario,omitempty"`
+	Seed         int64     `json:"seed,omitempty"`
+	Workers      []string  `json:"workers,omitempty"`
+	Percentiles  []float64 `json:"percentiles"`
+	StartTime    time.Time `json:"startTime"`
+	EndTime      time.Time `json:"endTime"`
+	Hostname     string    `json:"hostname,omitempty"`
+	GoVersion    string    `json:"goVersion"`
+}
+
+type phaseReport struct {
+	Name              string            `json:"name"`
+	ShowStat          bool              `json:"showStat"`
+	StartTime         time.Time         `json:"startTime"`
+	EndTime           *time.Time        `json:"endTime,omitempty"`
+	SentRequests      uint32            `json:"sentRequests"`
+	DroppedIterations uint32            `json:"droppedIterations"`
+	AllRequests       endpointReport    `json:"allRequests"`
+	Endpoints         []endpointReport  `json:"endpoints"`
+	Journeys          []journeyReport   `json:"journeys,omitempty"`
+	UserStates        []userStateReport `json:"userStates,omitempty"`
+}
+
+type endpointReport struct {
+	Endpoint         string             `json:"endpoint"`
+	Responses        uint64             `json:"responses"`
+	Errors           int                `json:"errors"`
+	ErrorBreakdown   map[string]int     `json:"errorBreakdown"`
+	ErrorClasses     []errorClassReport `json:"errorClasses"`
+	Latency          latencyReport      `json:"latency"`
+	CorrectedLatency latencyReport      `json:"correctedLatency"`
+	Throughput       []throughputPoint  `json:"throughput"`
+	ClientsNum       []clientsNumReport `json:"clientsNum"`
+	Connection       connectionReport   `json:"connection"`
+	Transfer         transferReport     `json:"transfer"`
+}
+
+type latencyReport struct {
+	Count       uint64             `json:"count"`
+	MinMs       float64            `json:"minMs"`
+	MeanMs      float64            `json:"meanMs"`
+	MaxMs       float64            `json:"maxMs"`
+	Percentiles map[string]float64 `json:"percentilesMs"`
+}
+
+type connectionReport struct {
+	NewConnections    uint64        `json:"newConnections"`
+	ReusedConnections uint64        `json:"reusedConnections"`
+	Dns               latencyReport `json:"dns"`
+	Connect           latencyReport `json:"connect"`
+	Tls               latencyReport `json:"tls"`
+	TimeToFirstByte   latencyReport `json:"timeToFirstByte"`
+	BodyDownload      latencyReport `json:"bodyDownload"`
+}
+
+// transferReport counts the request and response payload bytes, the rates are averaged over the phase
+type transferReport struct {
+	BytesSent           uint64  `json:"bytesSent"`
+	BytesReceived       uint64  `json:"bytesReceived"`
+	SentMBPerSecond     float64 `json:"sentMBPerSecond"`
+	ReceivedMBPerSecond float64 `json:"receivedMBPerSecond"`
+}
+
+type throughputPoint struct {
+	Time       time.Time `json:"time"`
+	Requests   uint64    `json:"requests"`
+	Cumulative uint64    `json:"cumulative"`
+	Errors     uint64    `json:"errors"`
+}
+
+type clientsNumReport struct {
+	Clients  int           `json:"clients"`
+	Requests uint64        `json:"requests"`
+	Latency  latencyReport `json:"latency"`
+}
+
+var (
+	reportMetadata = runMetadata{Command: "run"}
+
+	reportWriters = map[string]func(report *runReport, reportDir string) error{
+		"json": writeJsonReport,
+		"csv":  writeCsvReport,
+		"xlsx": writeXlsxReport,
+		"html": writeHtmlReport,
+	}
+)
+
+func buildRunReport() *runReport {
+	report := &runReport{Metadata: reportMetadata}
+
+	report.Metadata.Percentiles = reportPercentiles
+	report.Metadata.GoVersion = runtime.Version()
+	report.Metadata.Hostname, _ = os.Hostname()
+
+	muxPhaseStatistics.Lock()
+	history := append([]*phaseStats(nil), phaseStatsHistory...)
+	muxPhaseStatistics.Unlock()
+
+	for _, stats := range history {
+		report.Phases = append(report.Phases, stats.report())
+	}
+
+	return report
+}
+
+func (stats *phaseStats) report() phaseReport {
+	report := phaseReport{
+		Name:              stats.name,
+		ShowStat:          stats.showStat,
+		StartTime:         stats.startTime,
+		SentRequests:      atomic.LoadUint32(&stats.sentRequestsCount),
+		DroppedIterations: atomic.LoadUint32(&stats.droppedIterationsCount),
+		AllRequests:       stats.allEndpoints().report("all", stats.duration()),
+		Journeys:          stats.journeyReports(),
+		UserStates:        stats.userStateReports(),
+	}
+
+	if !stats.endTime.IsZero() {
+		endTime := stats.endTime
+		report.EndTime = &endTime
+	}
+
+	for _, endpoint := range stats.endpointNames() {
+		report.Endpoints = append(report.Endpoints, stats.endpoint(endpoint).report(endpoint, stats.duration()))
+	}
+
+	return report
+}
+
+func (stats *endpointStats) report(endpoint string, duration time.Duration) endpointReport {
+	report := endpointReport{
+		Endpoint:         endpoint,
+		Responses:        stats.responseTime.count(),
+		ErrorBreakdown:   make(map[string]int),
+		Latency:          newLatencyReport(stats.responseTime),
+		CorrectedLatency: newLatencyReport(stats.correctedResponseTime),
+		Throughput:       []throughputPoint{},
+		ClientsNum:       []clientsNumReport{},
+		Connection: connectionReport{
+			NewConnections:    atomic.LoadUint64(&stats.connection.newConnections),
+			ReusedConnections: atomic.LoadUint64(&stats.connection.reusedConnections),
+			Dns:               newLatencyReport(stats.connection.dns),
+			Connect:           newLatencyReport(stats.connection.connect),
+			Tls:               newLatencyReport(stats.connection.tls),
+			TimeToFirstByte:   newLatencyReport(stats.connection.firstByte),
+			BodyDownload:      newLatencyReport(stats.connection.bodyDownload),
+		},
+		Transfer:     stats.transferReport(duration),
+		ErrorClasses: stats.errorClasses(),
+	}
+
+	stats.muxErrors.Lock()
+	for key, count := range stats.errorBreakdown {
+		report.ErrorBreakdown[key] = count
+	}
+	stats.muxErrors.Unlock()
+	report.Errors = stats.errorsCount()
+
+	requestsNum, errorsNum := stats.requestsNum.values(), stats.errorsNum.values()
+	secondsNum := len(requestsNum)
+	if len(errorsNum) > secondsNum {
+		secondsNum = len(errorsNum)
+	}
+
+	var cumulativeRequests uint64
+	for second := 0; second < secondsNum; second++ {
+		point := throughputPoint{Time: stats.requestsNum.startTime.Add(time.Duration(second) * time.Second)}
+		if second < len(requestsNum) {
+			point.Requests = requestsNum[second]
+		}
+		if second < len(errorsNum) {
+			point.Errors = errorsNum[second]
+		}
+
+		cumulativeRequests += point.Requests
+		point.Cumulative = cumulativeRequests
+		report.Throughput = append(report.Throughput, point)
+	}
+
+	for _, clientsNum := range stats.clientsNumResponseTime.clientsNums() {
+		levelResponseTime := stats.clientsNumResponseTime.get(clientsNum)
+		report.ClientsNum = append(report.ClientsNum, clientsNumReport{
+			Clients:  clientsNum,
+			Requests: levelResponseTime.count(),
+			Latency:  newLatencyReport(levelResponseTime),
+		})
+	}
+
+	return report
+}
+
+func (stats *endpointStats) transferReport(duration time.Duration) transferReport {
+	report := transferReport{
+		BytesSent:     atomic.LoadUint64(&stats.bytesSent),
+		BytesReceived: atomic.LoadUint64(&stats.bytesReceived),
+	}
+
+	if duration > 0 {
+		report.SentMBPerSecond = float64(report.BytesSent) / bytesInMegabyte / duration.Seconds()
+		report.ReceivedMBPerSecond = float64(report.BytesReceived) / bytesInMegabyte / duration.Seconds()
+	}
+
+	return report
+}
+
+func newLatencyReport(responseTime *histogram) latencyReport {
+	report := latencyReport{
+		Count:       responseTime.count(),
+		MinMs:       milliseconds(responseTime.min()),
+		MeanMs:      milliseconds(responseTime.mean()),
+		MaxMs:       milliseconds(responseTime.max()),
+		Percentiles: make(map[string]float64),
+	}
+
+	for _, percentile := range reportPercentiles {
+		report.Percentiles[percentileKey(percentile)] = milliseconds(responseTime.valueAtPercentile(percentile))
+	}
+
+	return report
+}
+
+func percentileKey(percentile float64) string {
+	return "p" + formatPercentiles([]float64{percentile})
+}
+
+// errorBreakdownKey groups error messages that differ only in their details, such as the received body
+func errorBreakdownKey(message string) string {
+	if separatorIndex := strings.Index(message, ": "); separatorIndex >= 0 {
+		details := message[separatorIndex+2:]
+		if strings.Trim(details, "0123456789") != "" {
+			return message[:separatorIndex]
+		}
+	}
+	return message
+}
+
+func writeReports(reportDir string) error {
+	formats := make([]string, 0, len(reportFormats))
+	for format := range reportFormats {
+		if reportWriters[format] != nil {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		return nil
+	}
+	sort.Strings(formats)
+
+	report := buildRunReport()
+
+	for _, format := range formats {
+		if err := reportWriters[format](report, reportDir); err != nil {
+			return fmt.Errorf("unable to write %s report: %s", format, err)
+		}
+	}
+
+	return nil
+}
+
+func writeJsonReport(report *runReport, reportDir string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	reportPath := filepath.Join(reportDir, "Report.json")
+	if err := ioutil.WriteFile(reportPath, append(data, '\n'), 0666); err != nil {
+		return err
+	}
+
+	logStat.Printf("[MAIN] JSON report has been written to %s", reportPath)
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Raw samples are written to Samples.log as CSV so that a finished run can be re-analyzed or compared
+// with another run without repeating the benchmark.
+const (
+	sampleKindPhase     = "phase"
+	sampleKindDone      = "done"
+	sampleKindStat      = "stat"
+	sampleKindResponse  = "response"
+	sampleKindError     = "error"
+	sampleKindDropped   = "dropped"
+	sampleKindJourney   = "journey"
+	sampleKindUserState = "state"
+)
+
+var (
+	samplesColumns = []string{"kind", "endpoint", "time", "clients", "elapsed", "message", "intended", "expected_interval",
+		"trace_id", "reused", "dns", "connect", "tls", "first_byte", "body_download", "bytes_sent", "bytes_received",
+		"error_class", "dwell"}
+	requiredSamplesColumns = samplesColumns[:6]
+)
+
+var (
+	samplesOutfile  *os.File
+	samplesBuffer   *bufio.Writer
+	samplesWriter   *csv.Writer
+	muxSamplesWrite = &sync.Mutex{}
+)
+
+type sampleRecord struct {
+	kind       string
+	endpoint   string
+	time       time.Time
+	clientsNum int
+	elapsed    time.Duration
+	message    string
+
+	intendedTime     time.Time
+	expectedInterval time.Duration
+
+	traceId string
+
+	connection    connectionTimings
+	bytesSent     int64
+	bytesReceived int64
+
+	errorClass string
+
+	// dwellTime is the whole visit of a user model state, elapsed being the time of its requests only
+	dwellTime time.Duration
+}
+
+var connectionSampleColumns = []string{"dns", "connect", "tls", "first_byte", "body_download"}
+
+func (timings *connectionTimings) durations() []*time.Duration {
+	return []*time.Duration{&timings.dns, &timings.connect, &timings.tls, &timings.firstByte, &timings.bodyDownload}
+}
+
+func openSamples(path string) error {
+	outfile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create samples file: %s", err)
+	}
+
+	samplesOutfile = outfile
+	samplesBuffer = bufio.NewWriterSize(outfile, 64*1024)
+	samplesWriter = csv.NewWriter(samplesBuffer)
+
+	return samplesWriter.Write(samplesColumns)
+}
+
+func closeSamples() error {
+	if samplesWriter == nil {
+		return nil
+	}
+
+	muxSamplesWrite.Lock()
+	defer muxSamplesWrite.Unlock()
+
+	samplesWriter.Flush()
+	errWrite := samplesWriter.Error()
+	errFlush := samplesBuffer.Flush()
+	errClose := samplesOutfile.Close()
+	samplesWriter = nil
+
+	for _, err := range []error{errWrite, errFlush, errClose} {
+		if err != nil {
+			return fmt.Errorf("unable to write samples file: %s", err)
+		}
+	}
+	return nil
+}
+
+func writeSample(record sampleRecord) {
+	muxSamplesWrite.Lock()
+	defer muxSamplesWrite.Unlock()
+
+	if samplesWriter == nil {
+		return
+	}
+
+	intendedTime := record.intendedTime
+	if intendedTime.IsZero() {
+		intendedTime = record.time
+	}
+
+	fields := []string{
+		record.kind,
+		record.endpoint,
+		strconv.FormatInt(record.time.UnixNano(), 10),
+		strconv.Itoa(record.clientsNum),
+		strconv.FormatInt(int64(record.elapsed), 10),
+		record.message,
+		strconv.FormatInt(intendedTime.UnixNano(), 10),
+		strconv.FormatInt(int64(record.expectedInterval), 10),
+		record.traceId,
+	}
+
+	connectionFields := make([]string, 1+len(connectionSampleColumns))
+	if record.connection.traced {
+		connectionFields[0] = strconv.FormatBool(record.connection.reused)
+		for index, duration := range record.connection.durations() {
+			connectionFields[index+1] = strconv.FormatInt(int64(*duration), 10)
+		}
+	}
+	fields = append(fields, connectionFields...)
+
+	dwellTime := ""
+	if record.kind == sampleKindUserState {
+		dwellTime = strconv.FormatInt(int64(record.dwellTime), 10)
+	}
+
+	samplesWriter.Write(append(fields,
+		strconv.FormatInt(record.bytesSent, 10),
+		strconv.FormatInt(record.bytesReceived, 10),
+		record.errorClass,
+		dwellTime))
+}
+
+func readSamples(path string, handleRecord func(record sampleRecord)) error {
+	infile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer infile.Close()
+
+	reader := csv.NewReader(bufio.NewReader(infile))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("unable to read samples header of %s: %s", path, err)
+	}
+
+	columnIndexes := make(map[string]int)
+	for index, column := range header {
+		columnIndexes[column] = index
+	}
+	for _, column := range requiredSamplesColumns {
+		if _, ok := columnIndexes[column]; !ok {
+			return fmt.Errorf("samples file %s has no %q column", path, column)
+		}
+	}
+
+	for lineNumber := 2; ; lineNumber++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", path, lineNumber, err)
+		}
+
+		field := func(column string) string {
+			if index, ok := columnIndexes[column]; ok && index < len(fields) {
+				return fields[index]
+			}
+			return ""
+		}
+
+		timeNanoseconds, errTime := strconv.ParseInt(field("time"), 10, 64)
+		clientsNum, errClients := strconv.Atoi(field("clients"))
+		elapsed, errElapsed := strconv.ParseInt(field("elapsed"), 10, 64)
+		if errTime != nil || errClients != nil || errElapsed != nil {
+			return fmt.Errorf("%s:%d: malformed sample", path, lineNumber)
+		}
+
+		intendedNanoseconds, expectedInterval := timeNanoseconds, int64(0)
+		if field("intended") != "" {
+			intendedNanoseconds, errTime = strconv.ParseInt(field("intended"), 10, 64)
+			expectedInterval, errElapsed = strconv.ParseInt(field("expected_interval"), 10, 64)
+			if errTime != nil || errElapsed != nil {
+				return fmt.Errorf("%s:%d: malformed sample schedule", path, lineNumber)
+			}
+		}
+
+		var connection connectionTimings
+		if field("reused") != "" {
+			connection.traced = true
+			connection.reused, err = strconv.ParseBool(field("reused"))
+			for index, duration := range connection.durations() {
+				if err != nil {
+					break
+				}
+				var nanoseconds int64
+				nanoseconds, err = strconv.ParseInt(field(connectionSampleColumns[index]), 10, 64)
+				*duration = time.Duration(nanoseconds)
+			}
+			if err != nil {
+				return fmt.Errorf("%s:%d: malformed sample connection timings", path, lineNumber)
+			}
+		}
+
+		var bytesSent, bytesReceived int64
+		if field("bytes_sent") != "" {
+			bytesSent, errTime = strconv.ParseInt(field("bytes_sent"), 10, 64)
+			bytesReceived, errElapsed = strconv.ParseInt(field("bytes_received"), 10, 64)
+			if errTime != nil || errElapsed != nil {
+				return fmt.Errorf("%s:%d: malformed sample sizes", path, lineNumber)
+			}
+		}
+
+		// Older samples have no dwell time, their state latency included the think times
+		dwellTime := elapsed
+		if field("dwell") != "" {
+			if dwellTime, err = strconv.ParseInt(field("dwell"), 10, 64); err != nil {
+				return fmt.Errorf("%s:%d: malformed sample dwell time", path, lineNumber)
+			}
+		}
+
+		handleRecord(sampleRecord{
+			kind:       field("kind"),
+			endpoint:   field("endpoint"),
+			time:       time.Unix(0, timeNanoseconds),
+			clientsNum: clientsNum,
+			elapsed:    time.Duration(elapsed),
+			message:    field("message"),
+
+			intendedTime:     time.Unix(0, intendedNanoseconds),
+			expectedInterval: time.Duration(expectedInterval),
+
+			traceId: field("trace_id"),
+
+			connection:    connection,
+			bytesSent:     bytesSent,
+			bytesReceived: bytesReceived,
+
+			errorClass: field("error_class"),
+			dwellTime:  time.Duration(dwellTime),
+		})
+	}
+}
+
+func (record sampleRecord) errResponse() ErrResponse {
+	class := record.errorClass
+	if class == "" {
+		class = classifyErrorMessage(record.message)
+	}
+	return ErrResponse{time: record.time, class: class, message: record.message}
+}
+
+func (record sampleRecord) responseTime() ResponseTime {
+	return ResponseTime{
+		clientsNum:              record.clientsNum,
+		timeWhileSendingRequest: record.time,
+		intendedSendTime:        record.intendedTime,
+		expectedInterval:        record.expectedInterval,
+		elapsedTime:             record.elapsed,
+		bytesSent:               record.bytesSent,
+		bytesReceived:           record.bytesReceived,
+		connection:              record.connection,
+	}
+}
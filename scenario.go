@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Duration is a time.Duration that is written in scenario files as a Go duration string ("700ms", "5s")
+// or as a plain number of nanoseconds.
+type Duration time.Duration
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var durationString string
+	if err := json.Unmarshal(data, &durationString); err != nil {
+		nanoseconds, errParse := strconv.ParseInt(string(data), 10, 64)
+		if errParse != nil {
+			return fmt.Errorf("invalid duration %s", data)
+		}
+		*duration = Duration(nanoseconds)
+		return nil
+	}
+
+	parsedDuration, err := time.ParseDuration(durationString)
+	if err != nil {
+		return err
+	}
+	*duration = Duration(parsedDuration)
+	return nil
+}
+
+const (
+	executorClosedLoop  = "closed-loop"
+	executorArrivalRate = "arrival-rate"
+)
+
+// Phase describes one step of a benchmark. A phase with a positive RampStep starts with Clients clients and
+// every RampInterval launches a new batch, growing the batch by RampStep until MaxClients is reached.
+// A client waits SendDelay between its messages, or a random ThinkTime such as "lognormal:700ms,300ms".
+// The response times are reported under the clients number of the phase, or under ClientsLabel when given:
+// the built-in warm up runs 100 clients but has always been reported as 10 clients.
+//
+// An arrival-rate phase ignores the client fields: it starts Rate iterations per second during Duration,
+// where an iteration is one client message (get items, then buy the received items), and runs them on at
+// most MaxInFlight pre-allocated virtual users. Iterations that find no idle virtual user wait in a backlog
+// of at most MaxBacklog iterations, ten seconds of iterations by default, and are dropped once it is full.
+type Phase struct {
+	Name              string        `json:"name"`
+	Executor          string        `json:"executor,omitempty"`
+	Clients           int           `json:"clients,omitempty"`
+	MessagesPerClient int           `json:"messagesPerClient,omitempty"`
+	SendDelay         Duration      `json:"sendDelay,omitempty"`
+	ThinkTime         *distribution `json:"thinkTime,omitempty"`
+	RampStep          int           `json:"rampStep,omitempty"`
+	RampInterval      Duration      `json:"rampInterval,omitempty"`
+	MaxClients        int           `json:"maxClients,omitempty"`
+	ClientsLabel      int           `json:"clientsLabel,omitempty"`
+	Rate              float64       `json:"rate,omitempty"`
+	Duration          Duration      `json:"duration,omitempty"`
+	MaxInFlight       int           `json:"maxInFlight,omitempty"`
+	MaxBacklog        int           `json:"maxBacklog,omitempty"`
+	ShowStat          bool          `json:"showStat"`
+}
+
+// Scenario lists the phases of a benchmark. Validators configure how the responses of an endpoint are
+// checked, by default they must have the status 200 and exactly the expected body. A Journey, a weighted
+// mix of Journeys or a UserModel replaces the built-in client message of getting the items and buying
+// each of them.
+type Scenario struct {
+	Phases     []Phase                    `json:"phases"`
+	Validators map[string][]ValidatorSpec `json:"validators,omitempty"`
+	Journey    *Journey                   `json:"journey,omitempty"`
+	Journeys   []Journey                  `json:"journeys,omitempty"`
+	UserModel  *UserModel                 `json:"userModel,omitempty"`
+}
+
+// thinkTime is the delay a client of the phase waits between its messages
+func (phase Phase) thinkTime() distribution {
+	if phase.ThinkTime != nil {
+		return *phase.ThinkTime
+	}
+	return distribution{kind: distributionConstant, params: []time.Duration{time.Duration(phase.SendDelay)}}
+}
+
+func (scenario *Scenario) journeys() []Journey {
+	if scenario.Journey != nil {
+		return append([]Journey{*scenario.Journey}, scenario.Journeys...)
+	}
+	return scenario.Journeys
+}
+
+func defaultScenario() *Scenario {
+	return &Scenario{Phases: []Phase{
+		{
+			Name:              "Warm up",
+			Clients:           100,
+			MessagesPerClient: 10,
+			SendDelay:         Duration(700 * time.Millisecond),
+			ClientsLabel:      10,
+		},
+		{
+			Name:              "Load tests with a large number of clients",
+			Clients:           10,
+			MessagesPerClient: 10,
+			SendDelay:         Duration(700 * time.Millisecond),
+			RampStep:          10,
+			RampInterval:      Duration(5 * time.Second),
+			MaxClients:        300,
+			ShowStat:          true,
+		},
+		{
+			Name:              "Load tests with a large number of requests from each client",
+			Clients:           4,
+			MessagesPerClient: 1000,
+			SendDelay:         Duration(200 * time.Millisecond),
+			ShowStat:          true,
+		},
+	}}
+}
+
+func loadScenario(path string) (*Scenario, error) {
+	if path == "" {
+		return defaultScenario(), nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scenario := &Scenario{}
+	if err := json.Unmarshal(data, scenario); err != nil {
+		return nil, fmt.Errorf("unable to parse scenario file %s: %s", path, err)
+	}
+
+	if err := scenario.loadHistograms(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("invalid scenario file %s: %s", path, err)
+	}
+
+	if err := scenario.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario file %s: %s", path, err)
+	}
+
+	return scenario, nil
+}
+
+// loadHistograms reads the histograms of the empirical think times of the phases, journey steps and user
+// model states, relative paths are taken from baseDirectory
+func (scenario *Scenario) loadHistograms(baseDirectory string) error {
+	for _, phase := range scenario.Phases {
+		if err := phase.ThinkTime.loadHistogram(baseDirectory); err != nil {
+			return fmt.Errorf("phase %s: %s", phase.Name, err)
+		}
+	}
+
+	for _, journey := range scenario.journeys() {
+		for stepIndex, step := range journey.Steps {
+			if err := step.ThinkTime.loadHistogram(baseDirectory); err != nil {
+				return fmt.Errorf("journey %s, step %d: %s", journey.Name, stepIndex, err)
+			}
+		}
+	}
+
+	if scenario.UserModel != nil {
+		for _, state := range scenario.UserModel.States {
+			if err := state.ThinkTime.loadHistogram(baseDirectory); err != nil {
+				return fmt.Errorf("user model, state %s: %s", state.Name, err)
+			}
+			for stepIndex, step := range state.Steps {
+				if err := step.ThinkTime.loadHistogram(baseDirectory); err != nil {
+					return fmt.Errorf("user model, state %s, step %d: %s", state.Name, stepIndex, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (scenario *Scenario) validate() error {
+	if len(scenario.Phases) == 0 {
+		return errors.New("no phases defined")
+	}
+
+	if _, err := buildValidators(scenario.Validators); err != nil {
+		return err
+	}
+	if scenario.Journey != nil && len(scenario.Journeys) > 0 {
+		return errors.New("either journey or journeys may be given, not both")
+	}
+	if _, err := compileJourneys(scenario.journeys()); err != nil {
+		return err
+	}
+	if scenario.UserModel != nil && len(scenario.journeys()) > 0 {
+		return errors.New("either journeys or a user model may be given, not both")
+	}
+	if _, err := compileUserModel(scenario.UserModel); err != nil {
+		return err
+	}
+
+	for index, phase := range scenario.Phases {
+		if phase.Name == "" {
+			return fmt.Errorf("phase %d: name is required", index)
+		}
+		switch phase.Executor {
+		case "", executorClosedLoop:
+		case executorArrivalRate:
+			if phase.Rate <= 0 {
+				return fmt.Errorf("phase %q: rate must be positive", phase.Name)
+			}
+			if phase.Duration <= 0 {
+				return fmt.Errorf("phase %q: duration must be positive", phase.Name)
+			}
+			if phase.MaxInFlight <= 0 {
+				return fmt.Errorf("phase %q: maxInFlight must be positive", phase.Name)
+			}
+			if phase.MaxBacklog < 0 {
+				return fmt.Errorf("phase %q: maxBacklog must not be negative", phase.Name)
+			}
+			continue
+		default:
+			return fmt.Errorf("phase %q: unknown executor %q", phase.Name, phase.Executor)
+		}
+
+		if phase.Clients <= 0 {
+			return fmt.Errorf("phase %q: clients must be positive", phase.Name)
+		}
+		if phase.MessagesPerClient <= 0 {
+			return fmt.Errorf("phase %q: messagesPerClient must be positive", phase.Name)
+		}
+		if phase.SendDelay < 0 {
+			return fmt.Errorf("phase %q: sendDelay must not be negative", phase.Name)
+		}
+		if phase.SendDelay > 0 && phase.ThinkTime != nil {
+			return fmt.Errorf("phase %q: either sendDelay or thinkTime may be given, not both", phase.Name)
+		}
+		if phase.RampStep < 0 {
+			return fmt.Errorf("phase %q: rampStep must not be negative", phase.Name)
+		}
+		if phase.ClientsLabel < 0 {
+			return fmt.Errorf("phase %q: clientsLabel must not be negative", phase.Name)
+		}
+		if phase.RampStep > 0 {
+			if phase.ClientsLabel > 0 {
+				return fmt.Errorf("phase %q: clientsLabel is not supported by a ramping phase", phase.Name)
+			}
+			if phase.RampInterval <= 0 {
+				return fmt.Errorf("phase %q: rampInterval must be positive for a ramping phase", phase.Name)
+			}
+			if phase.MaxClients < phase.Clients {
+				return fmt.Errorf("phase %q: maxClients must not be less than clients", phase.Name)
+			}
+		}
+	}
+
+	return nil
+}
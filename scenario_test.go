@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhaseReportsItsClientsLabel(t *testing.T) {
+	startIdleTestShop(t)
+
+	warmUp := defaultScenario().Phases[0]
+	if warmUp.Clients != 100 || warmUp.ClientsLabel != 10 {
+		t.Errorf("the built-in warm up runs %d clients reported as %d, expected 100 reported as 10",
+			warmUp.Clients, warmUp.ClientsLabel)
+	}
+
+	runPhase(Phase{Name: "Labelled", Clients: 3, MessagesPerClient: 1, ClientsLabel: 1})
+
+	if clientsNums := currentPhaseStats.endpoint("/").clientsNumResponseTime.clientsNums(); len(clientsNums) != 1 ||
+		clientsNums[0] != 1 {
+		t.Errorf("the response times are reported for %v clients, expected the label 1", clientsNums)
+	}
+	if count := currentPhaseStats.endpoint("/").responseTime.count(); count != 3 {
+		t.Errorf("the phase sent %d get items requests, expected one per client of 3", count)
+	}
+}
+
+func TestValidateClientsLabel(t *testing.T) {
+	ramping := Phase{Name: "Ramp", Clients: 1, MessagesPerClient: 1, RampStep: 1,
+		RampInterval: Duration(time.Second), MaxClients: 2, ClientsLabel: 1}
+	err := (&Scenario{Phases: []Phase{ramping}}).validate()
+	if err == nil || !strings.Contains(err.Error(), "clientsLabel is not supported by a ramping phase") {
+		t.Errorf("error is %v, expected the unsupported clientsLabel", err)
+	}
+
+	if err := defaultScenario().validate(); err != nil {
+		t.Errorf("the built-in scenario is invalid: %s", err)
+	}
+}
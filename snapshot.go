@@ -0,0 +1,284 @@
+package main
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// PhaseSnapshot is the serializable form of phaseStats that workers send to the coordinator
+type PhaseSnapshot struct {
+	Name                string
+	StartTime           time.Time
+	EndTime             time.Time
+	SentRequests        uint32
+	DroppedIterations   uint32
+	Endpoints           map[string]EndpointSnapshot
+	Journeys            map[string]JourneySnapshot
+	UserStates          map[string]JourneySnapshot
+	UserStateDwellTimes map[string]HistogramSnapshot
+}
+
+type JourneySnapshot struct {
+	Duration       HistogramSnapshot
+	Completed      uint64
+	Failed         uint64
+	FailureClasses map[string]uint64
+}
+
+type EndpointSnapshot struct {
+	ResponseTime           HistogramSnapshot
+	CorrectedResponseTime  HistogramSnapshot
+	ClientsNumResponseTime map[int]HistogramSnapshot
+	RequestsNum            TimeSeriesSnapshot
+	ErrorsNum              TimeSeriesSnapshot
+	Connection             ConnectionSnapshot
+	BytesSent              uint64
+	BytesReceived          uint64
+	ErrorClasses           map[string]ErrorClassSnapshot
+	ErrorBreakdown         map[string]int
+}
+
+type ConnectionSnapshot struct {
+	Dns               HistogramSnapshot
+	Connect           HistogramSnapshot
+	Tls               HistogramSnapshot
+	FirstByte         HistogramSnapshot
+	BodyDownload      HistogramSnapshot
+	NewConnections    uint64
+	ReusedConnections uint64
+}
+
+// HistogramSnapshot keeps only the non-empty buckets of a histogram
+type HistogramSnapshot struct {
+	SignificantDigits int
+	Indexes           []int
+	Counts            []uint64
+	TotalSum          uint64
+	MinValue          int64
+	MaxValue          int64
+}
+
+type TimeSeriesSnapshot struct {
+	StartTime time.Time
+	Counts    []uint64
+}
+
+type ErrorClassSnapshot struct {
+	Count     int
+	PerSecond TimeSeriesSnapshot
+	Examples  []ErrorExampleSnapshot
+}
+
+type ErrorExampleSnapshot struct {
+	Time    time.Time
+	Message string
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	snapshot := HistogramSnapshot{
+		SignificantDigits: h.significantDigits,
+		TotalSum:          atomic.LoadUint64(&h.totalSum),
+		MinValue:          atomic.LoadInt64(&h.minValue),
+		MaxValue:          atomic.LoadInt64(&h.maxValue),
+	}
+
+	for index := range h.counts {
+		if count := atomic.LoadUint64(&h.counts[index]); count > 0 {
+			snapshot.Indexes = append(snapshot.Indexes, index)
+			snapshot.Counts = append(snapshot.Counts, count)
+		}
+	}
+
+	return snapshot
+}
+
+func (snapshot HistogramSnapshot) histogram() *histogram {
+	h := newHistogram(snapshot.SignificantDigits)
+
+	for position, index := range snapshot.Indexes {
+		if index < 0 || index >= len(h.counts) {
+			continue
+		}
+		h.counts[index] += snapshot.Counts[position]
+		h.totalCount += snapshot.Counts[position]
+	}
+	if h.totalCount > 0 {
+		h.totalSum = snapshot.TotalSum
+		h.minValue = snapshot.MinValue
+		h.maxValue = snapshot.MaxValue
+	}
+
+	return h
+}
+
+func (series *timeSeries) snapshot() TimeSeriesSnapshot {
+	return TimeSeriesSnapshot{StartTime: series.startTime, Counts: series.values()}
+}
+
+func (snapshot TimeSeriesSnapshot) timeSeries() *timeSeries {
+	return &timeSeries{startTime: snapshot.StartTime, counts: append([]uint64(nil), snapshot.Counts...)}
+}
+
+func (stats *connectionStats) snapshot() ConnectionSnapshot {
+	return ConnectionSnapshot{
+		Dns:               stats.dns.snapshot(),
+		Connect:           stats.connect.snapshot(),
+		Tls:               stats.tls.snapshot(),
+		FirstByte:         stats.firstByte.snapshot(),
+		BodyDownload:      stats.bodyDownload.snapshot(),
+		NewConnections:    atomic.LoadUint64(&stats.newConnections),
+		ReusedConnections: atomic.LoadUint64(&stats.reusedConnections),
+	}
+}
+
+func (snapshot ConnectionSnapshot) connectionStats() *connectionStats {
+	return &connectionStats{
+		dns:               snapshot.Dns.histogram(),
+		connect:           snapshot.Connect.histogram(),
+		tls:               snapshot.Tls.histogram(),
+		firstByte:         snapshot.FirstByte.histogram(),
+		bodyDownload:      snapshot.BodyDownload.histogram(),
+		newConnections:    snapshot.NewConnections,
+		reusedConnections: snapshot.ReusedConnections,
+	}
+}
+
+func (stats *endpointStats) snapshot() EndpointSnapshot {
+	snapshot := EndpointSnapshot{
+		ResponseTime:           stats.responseTime.snapshot(),
+		CorrectedResponseTime:  stats.correctedResponseTime.snapshot(),
+		ClientsNumResponseTime: make(map[int]HistogramSnapshot),
+		RequestsNum:            stats.requestsNum.snapshot(),
+		ErrorsNum:              stats.errorsNum.snapshot(),
+		Connection:             stats.connection.snapshot(),
+		BytesSent:              atomic.LoadUint64(&stats.bytesSent),
+		BytesReceived:          atomic.LoadUint64(&stats.bytesReceived),
+	}
+
+	for _, clientsNum := range stats.clientsNumResponseTime.clientsNums() {
+		snapshot.ClientsNumResponseTime[clientsNum] = stats.clientsNumResponseTime.get(clientsNum).snapshot()
+	}
+
+	stats.muxErrors.Lock()
+	snapshot.ErrorClasses = make(map[string]ErrorClassSnapshot)
+	for name, class := range stats.errorClassesStats {
+		classSnapshot := ErrorClassSnapshot{Count: class.count, PerSecond: class.perSecond.snapshot()}
+		for _, example := range class.examples {
+			classSnapshot.Examples = append(classSnapshot.Examples,
+				ErrorExampleSnapshot{Time: example.Time, Message: example.Message})
+		}
+		snapshot.ErrorClasses[name] = classSnapshot
+	}
+	snapshot.ErrorBreakdown = make(map[string]int)
+	for key, count := range stats.errorBreakdown {
+		snapshot.ErrorBreakdown[key] = count
+	}
+	stats.muxErrors.Unlock()
+
+	return snapshot
+}
+
+func (snapshot EndpointSnapshot) endpointStats() *endpointStats {
+	stats := &endpointStats{
+		responseTime:           snapshot.ResponseTime.histogram(),
+		correctedResponseTime:  snapshot.CorrectedResponseTime.histogram(),
+		clientsNumResponseTime: newClientsNumHistograms(),
+		requestsNum:            snapshot.RequestsNum.timeSeries(),
+		errorsNum:              snapshot.ErrorsNum.timeSeries(),
+		connection:             snapshot.Connection.connectionStats(),
+		bytesSent:              snapshot.BytesSent,
+		bytesReceived:          snapshot.BytesReceived,
+		errorClassesStats:      make(map[string]*errorClassStats),
+		errorBreakdown:         make(map[string]int),
+		errorsRandom:           rand.New(rand.NewSource(snapshot.ErrorsNum.StartTime.UnixNano())),
+	}
+
+	for clientsNum, levelSnapshot := range snapshot.ClientsNumResponseTime {
+		stats.clientsNumResponseTime.histograms[clientsNum] = levelSnapshot.histogram()
+	}
+
+	for name, classSnapshot := range snapshot.ErrorClasses {
+		class := &errorClassStats{count: classSnapshot.Count, perSecond: classSnapshot.PerSecond.timeSeries()}
+		for _, example := range classSnapshot.Examples {
+			class.examples = append(class.examples, errorExample{Time: example.Time, Message: example.Message})
+		}
+		stats.errorClassesStats[name] = class
+	}
+	for key, count := range snapshot.ErrorBreakdown {
+		stats.errorBreakdown[key] = count
+	}
+
+	return stats
+}
+
+func (stats *phaseStats) snapshot() PhaseSnapshot {
+	snapshot := PhaseSnapshot{
+		Name:              stats.name,
+		StartTime:         stats.startTime,
+		EndTime:           stats.endTime,
+		SentRequests:      atomic.LoadUint32(&stats.sentRequestsCount),
+		DroppedIterations: atomic.LoadUint32(&stats.droppedIterationsCount),
+		Endpoints:         make(map[string]EndpointSnapshot),
+	}
+
+	for _, endpoint := range stats.endpointNames() {
+		snapshot.Endpoints[endpoint] = stats.endpoint(endpoint).snapshot()
+	}
+
+	stats.muxJourneys.Lock()
+	snapshot.Journeys = journeySnapshots(stats.journeys)
+	snapshot.UserStates = journeySnapshots(stats.userStates)
+	snapshot.UserStateDwellTimes = make(map[string]HistogramSnapshot)
+	for name, dwellTimes := range stats.userStateDwellTimes {
+		snapshot.UserStateDwellTimes[name] = dwellTimes.snapshot()
+	}
+	stats.muxJourneys.Unlock()
+
+	return snapshot
+}
+
+func journeySnapshots(runs map[string]*journeyStats) map[string]JourneySnapshot {
+	snapshots := make(map[string]JourneySnapshot)
+	for name, journey := range runs {
+		journeySnapshot := JourneySnapshot{Duration: journey.duration.snapshot(), Completed: journey.completed,
+			Failed: journey.failed, FailureClasses: make(map[string]uint64)}
+		for class, count := range journey.failureClasses {
+			journeySnapshot.FailureClasses[class] = count
+		}
+		snapshots[name] = journeySnapshot
+	}
+	return snapshots
+}
+
+func (snapshot JourneySnapshot) journeyStats() *journeyStats {
+	journey := &journeyStats{duration: snapshot.Duration.histogram(), completed: snapshot.Completed,
+		failed: snapshot.Failed, failureClasses: make(map[string]uint64)}
+	for class, count := range snapshot.FailureClasses {
+		journey.failureClasses[class] = count
+	}
+	return journey
+}
+
+func (snapshot PhaseSnapshot) phaseStats() *phaseStats {
+	stats := newPhaseStats(snapshot.Name, snapshot.StartTime)
+	stats.endTime = snapshot.EndTime
+	stats.sentRequestsCount = snapshot.SentRequests
+	stats.droppedIterationsCount = snapshot.DroppedIterations
+
+	for endpoint, endpointSnapshot := range snapshot.Endpoints {
+		stats.endpoints[endpoint] = endpointSnapshot.endpointStats()
+	}
+
+	for name, journeySnapshot := range snapshot.Journeys {
+		stats.journeys[name] = journeySnapshot.journeyStats()
+	}
+	for name, stateSnapshot := range snapshot.UserStates {
+		stats.userStates[name] = stateSnapshot.journeyStats()
+	}
+	for name, dwellTimesSnapshot := range snapshot.UserStateDwellTimes {
+		stats.userStateDwellTimes[name] = dwellTimesSnapshot.histogram()
+	}
+
+	return stats
+}
@@ -8,9 +8,9 @@ import (
 	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,49 +19,43 @@ import (
 )
 
 var (
-	logInfoOutfile, _  = os.OpenFile("./logs/Info.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	logErrorOutfile, _ = os.OpenFile("./logs/Error.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	logStatOutfile, _  = os.OpenFile("./logs/Stat.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	logInfo  = log.New(ioutil.Discard, "INFO: ", log.Ltime)
+	logError = log.New(os.Stderr, "ERROR: ", log.Ltime)
+	logStat  = log.New(os.Stdout, "STAT: ", log.Ltime)
 
-	logInfo  = log.New(logInfoOutfile, "INFO: ", log.Ltime)
-	logError = log.New(logErrorOutfile, "ERROR: ", log.Ltime)
-	logStat  = log.New(logStatOutfile, "STAT: ", log.Ltime)
+	serverUrl = "http://localhost:8080"
+	random    *rand.Rand
 
 	testClientsNum        int
 	testClientMessagesNum int
 
-	totalMessagesCount uint32
-
-	getItemsErrors    []ErrResponse
-	muxGetItemsErrors *sync.Mutex
-	buyItemsErrors    []ErrResponse
-	muxBuyItemsErrors *sync.Mutex
-
-	getItemsResponseTimeSlice    []ResponseTime
-	muxGetItemsResponseTimeSlice *sync.Mutex
-	buyItemsResponseTimeSlice    []ResponseTime
-	muxBuyItemsResponseTimeSlice *sync.Mutex
-
 	myClient *http.Client
 
 	requestClientNames = []string{"", "saneexclamation", "buythroated", "infuriatedlutchet", "ticketbright", "insecureloudmouth", "soundingindirect", "knowledgewives", "gearherring", "farmershortcrust", "variablehertz", "ripplinglens", "otherscontrol", "turnhotsprings", "veincelery", "excessfamily", "iceskatesbale", "ruffsescape", "pencilelements", "yellstable", "mushroomslomo", "edgecord", "possessivegreeting", "hertzodds", "groaninfected", "interiorrotating", "firechargeenzyme", "sickshower", "leukocytedrink", "prominencetub", "fieldsmustache", "woodcocklawful", "leatherarmy", "achernarinstance", "europalepton", "planesalami", "customersworkbench", "infinityhatching", "plughumbug", "competingfag", "farrumscut", "perpetualfallen", "unwittinglaying", "dirtycopernicium", "icehockeymeteoroid", "merseybeatstarbucks", "milkperoxide", "flingwater", "flagrantcoins", "kraftzing", "fellsargon", "bobstaysloshed", "trymercury", "freegantonic", "barnacleburnt", "masonsstrawberry", "delayedmale", "xiphoidtutor", "asheatable", "tengmalmshingles", "aquilabummage", "spotsbiceps", "violinanother", "tawnysyntax", "frogsfeisty", "nodulespity", "calledpliocene", "soddinggluttonous", "billowygillette", "stuffboson", "collarbonelargest", "parliamentblizzard", "sadmarkings", "streetsbailey", "surfernissan", "democracydividers", "alloythine", "frugalmust", "plancaplay", "normalaleutian", "stingandalusian", "skuaallee", "intendedshark", "paradigmboards", "ventureskeg", "kalmansledder", "plaindolphin", "singermention", "employvolta", "womenthorough", "huhshare", "grumpycepheus", "magnetremuda", "moralsdisrupt", "correctfierce", "rollmetrics", "skeinboiling", "amiablebiotic", "actmind", "baconsiphon", "complexvenison"}
 )
 
-const (
-	//serverUrl = "http://185.143.173.31"
-	serverUrl         = "http://localhost:8080"
-	warmUpClientsNum  = 100
-	testMaxClientsNum = 300
-)
-
 type ResponseTime struct {
 	clientsNum              int
 	timeWhileSendingRequest time.Time
+	intendedSendTime        time.Time
+	expectedInterval        time.Duration
 	elapsedTime             time.Duration
+	bytesSent               int64
+	bytesReceived           int64
+	connection              connectionTimings
+}
+
+// requestResult is a received response, or the error that prevented it with the status code -1
+type requestResult struct {
+	statusCode int
+	header     http.Header
+	body       string
+	err        error
 }
 
 type ErrResponse struct {
 	time    time.Time
+	class   string
 	message string
 }
 
@@ -70,27 +64,13 @@ func (err *ErrResponse) Error() string {
 }
 
 func Init() {
-	totalMessagesCount = 0
-
-	getItemsErrors = make([]ErrResponse, 0)
-	buyItemsErrors = make([]ErrResponse, 0)
+	currentPhaseStats = newPhaseStats("", time.Now())
 
-	getItemsResponseTimeSlice = make([]ResponseTime, 0)
-	buyItemsResponseTimeSlice = make([]ResponseTime, 0)
-
-	muxGetItemsErrors = &sync.Mutex{}
-	muxBuyItemsErrors = &sync.Mutex{}
-	muxGetItemsResponseTimeSlice = &sync.Mutex{}
-	muxBuyItemsResponseTimeSlice = &sync.Mutex{}
-
-	defaultRoundTripper := http.DefaultTransport
-	defaultTransportPointer, _ := defaultRoundTripper.(*http.Transport)
-
-	defaultTransport := *defaultTransportPointer
+	defaultTransport := http.DefaultTransport.(*http.Transport).Clone()
 	defaultTransport.MaxIdleConns = 5000
 	defaultTransport.MaxIdleConnsPerHost = 5000
 
-	myClient = &http.Client{Transport: &defaultTransport}
+	myClient = &http.Client{Transport: defaultTransport}
 }
 
 type ResponseBody struct {
@@ -164,27 +144,48 @@ func getExpectedBuyItemsResponse(itemName string) string {
 	return string(jsonBody)
 }
 
-func checkResponse(
-	objectName, response string, statusCode int, getExpectedResponse func(objectName string) string) *ErrResponse {
+// checkResponse validates a response with the validators of the endpoint, getExpectedResponse is nil for
+// an endpoint without a built-in expected response
+func checkResponse(endpoint, objectName string, result requestResult,
+	getExpectedResponse func(objectName string) string) *ErrResponse {
 
-	expectedResponse := getExpectedResponse(objectName)
+	if result.err != nil {
+		return &ErrResponse{time: time.Now(), class: classifyTransportError(result.err),
+			message: "bad response: " + result.err.Error()}
+	}
 
-	if statusCode != 200 {
-		if statusCode == -1 {
-			return &ErrResponse{time: time.Now(), message: "bad response"}
-		}
-		return &ErrResponse{time: time.Now(), message: "wrong status code: " + strconv.Itoa(statusCode)}
+	response := validatedResponse{statusCode: result.statusCode, header: result.header, body: result.body}
+	if getExpectedResponse != nil {
+		response.expected = getExpectedResponse(objectName)
 	}
 
-	if response != expectedResponse {
-		return &ErrResponse{time: time.Now(), message: "wrong response body: " + response +
-			" | Expected: " + expectedResponse}
+	for _, validator := range validatorsOf(endpoint) {
+		if err := validator.Validate(response); err != nil {
+			errResponse := &ErrResponse{time: time.Now(), class: errorClassValidatorFailed, message: err.Error()}
+			if validationErr, ok := err.(*validationError); ok {
+				errResponse.class = validationErr.class
+			}
+			return errResponse
+		}
 	}
 
 	return nil
 }
 
-func sendRequest(resource, queryParams, contentType, body string) (statusCode int, responseBody string) {
+// requestParams describe a request: a GET with the query params, or a POST of the body in the json form
+// field when the body is not empty. The statistics are recorded for the endpoint, which is also the URL
+// path unless a path is given.
+type requestParams struct {
+	endpoint    string
+	path        string
+	queryParams string
+	contentType string
+	body        string
+}
+
+func sendRequest(params requestParams, schedule messageSchedule, span *requestSpan) requestResult {
+	resource, queryParams, contentType, body := params.endpoint, params.queryParams, params.contentType, params.body
+
 	var request *http.Request
 	var errRequestCreate error
 
@@ -196,6 +197,9 @@ func sendRequest(resource, queryParams, contentType, body string) (statusCode in
 
 	u, _ := url.ParseRequestURI(serverUrl)
 	u.Path = resource
+	if params.path != "" {
+		u.Path = params.path
+	}
 	requestUrl := u.String()
 
 	if body == "" {
@@ -207,7 +211,7 @@ func sendRequest(resource, queryParams, contentType, body string) (statusCode in
 		if errRequestCreate != nil {
 			logError.Printf("[Send Request] Unable to create new request with query params. "+
 				"Error: %s", errRequestCreate)
-			return -1, ""
+			return requestResult{statusCode: -1, err: errRequestCreate}
 		}
 	} else {
 		switch contentType {
@@ -221,7 +225,7 @@ func sendRequest(resource, queryParams, contentType, body string) (statusCode in
 			if errRequestCreate != nil {
 				logError.Printf("[Send Request] Unable to create new request with urlencoded body. "+
 					"Error: %s", errRequestCreate)
-				return -1, ""
+				return requestResult{statusCode: -1, err: errRequestCreate}
 			}
 
 			request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
@@ -239,61 +243,98 @@ func sendRequest(resource, queryParams, contentType, body string) (statusCode in
 			if errRequestCreate != nil {
 				logError.Printf("[Send Request] Unable to create new request with multipart/form-data body. "+
 					"Error: %s", errRequestCreate)
-				return -1, ""
+				return requestResult{statusCode: -1, err: errRequestCreate}
 			}
 
 			request.Header.Set("Content-Type", writer.FormDataContentType())
 		}
 	}
 
+	request.Header.Set("traceparent", span.traceparent())
+	span.method = request.Method
+	span.url = requestUrl
+
+	trace := &connectionTrace{}
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace.clientTrace()))
+
+	liveMetrics.requestStarted()
 	sendingStartTime = time.Now()
 	response, errResponse = myClient.Do(request)
 	sendingEndTime = time.Now()
 
+	// the response is complete only once its body has been read, so the body read is a part of the response time
+	var responseBytes []byte
+	headersReceivedTime := sendingEndTime
+	if errResponse == nil {
+		responseBytes, errResponse = ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		sendingEndTime = time.Now()
+	}
+
+	span.startTime, span.endTime = sendingStartTime, sendingEndTime
+	liveMetrics.requestFinished(sendingEndTime.Sub(sendingStartTime), errResponse == nil)
+
+	metric := requestMetric{time: sendingStartTime, phase: currentPhaseStats.name, endpoint: resource,
+		encoding: requestEncoding(body, contentType), statusCode: -1, elapsedTime: sendingEndTime.Sub(sendingStartTime)}
+	if errResponse == nil {
+		metric.statusCode = response.StatusCode
+	}
+	runMetrics.recordRequest(metric)
+	recordRequestMetric(metric)
+
 	responseTime := ResponseTime{}
 	responseTime.clientsNum = testClientsNum
 	responseTime.timeWhileSendingRequest = sendingStartTime
+	responseTime.intendedSendTime = sendingStartTime.Add(-schedule.lateness)
+	responseTime.expectedInterval = schedule.expectedInterval
 	responseTime.elapsedTime = sendingEndTime.Sub(sendingStartTime)
 
 	if errResponse != nil {
 		logError.Printf("[Send Request] Got error response. Error message: %s", errResponse)
-		return -1, ""
+		span.sendError = errResponse.Error()
+		writeSample(sampleRecord{kind: sampleKindResponse, endpoint: resource, time: sendingStartTime,
+			clientsNum: responseTime.clientsNum, elapsed: responseTime.elapsedTime, message: errResponse.Error(),
+			traceId: span.traceIdString()})
+		return requestResult{statusCode: -1, err: errResponse}
 	}
+	span.statusCode = response.StatusCode
 
-	defer response.Body.Close()
-
-	switch resource {
-	case "/":
-		muxGetItemsResponseTimeSlice.Lock()
-		getItemsResponseTimeSlice = append(getItemsResponseTimeSlice, responseTime)
-		muxGetItemsResponseTimeSlice.Unlock()
-	case "/buy":
-		muxBuyItemsResponseTimeSlice.Lock()
-		buyItemsResponseTimeSlice = append(buyItemsResponseTimeSlice, responseTime)
-		muxBuyItemsResponseTimeSlice.Unlock()
+	if request.ContentLength > 0 {
+		responseTime.bytesSent = request.ContentLength
 	}
+	responseTime.bytesReceived = int64(len(responseBytes))
+	responseTime.connection = trace.timings(sendingStartTime, headersReceivedTime, sendingEndTime)
+
+	currentPhaseStats.recordResponseTime(resource, responseTime)
+	writeSample(sampleRecord{kind: sampleKindResponse, endpoint: resource, time: responseTime.timeWhileSendingRequest,
+		clientsNum: responseTime.clientsNum, elapsed: responseTime.elapsedTime,
+		intendedTime: responseTime.intendedSendTime, expectedInterval: responseTime.expectedInterval,
+		bytesSent: responseTime.bytesSent, bytesReceived: responseTime.bytesReceived,
+		connection: responseTime.connection, traceId: span.traceIdString()})
 
-	responseBytes, _ := ioutil.ReadAll(response.Body)
-	return response.StatusCode, string(responseBytes)
+	return requestResult{statusCode: response.StatusCode, header: response.Header, body: string(responseBytes)}
 }
 
-func BuyItems(currentClientNumber int, contentType string, items []Item) {
+func BuyItems(currentClientNumber, currentMessageNumber int, contentType string, items []Item, schedule messageSchedule) {
 	for index, currentItem := range items {
-		atomic.AddUint32(&totalMessagesCount, 1)
+		atomic.AddUint32(&currentPhaseStats.sentRequestsCount, 1)
 
 		requestBody, _ := json.Marshal(currentItem)
 
-		responseStatusCode, responseBody := sendRequest("/buy", "", contentType, string(requestBody))
+		span := startRequestSpan("/buy", currentClientNumber, currentMessageNumber, index)
+		result := sendRequest(requestParams{endpoint: "/buy", contentType: contentType, body: string(requestBody)}, schedule, span)
 
-		if resultCheck :=
-			checkResponse(currentItem.Name, responseBody, responseStatusCode, getExpectedBuyItemsResponse); resultCheck != nil {
+		resultCheck := checkResponse("/buy", currentItem.Name, result, getExpectedBuyItemsResponse)
+		span.end(resultCheck)
+
+		if resultCheck != nil {
 
 			logError.Printf("[Goroutine %d][Message %d][Buy Items Test] Got invalid response. "+
 				"Error Message: %s", currentClientNumber, index, resultCheck)
 
-			muxBuyItemsErrors.Lock()
-			buyItemsErrors = append(buyItemsErrors, *resultCheck)
-			muxBuyItemsErrors.Unlock()
+			currentPhaseStats.recordError("/buy", *resultCheck)
+			writeSample(sampleRecord{kind: sampleKindError, endpoint: "/buy", time: resultCheck.time,
+				errorClass: resultCheck.class, message: resultCheck.message, traceId: span.traceIdString()})
 		} else {
 			logInfo.Printf("[Goroutine %d][Message %d][Buy Items Test] Got valid response",
 				currentClientNumber, index)
@@ -301,45 +342,73 @@ func BuyItems(currentClientNumber int, contentType string, items []Item) {
 	}
 }
 
-func startTestClient(userName, queryParam, contentType, body string, currentClientNumber int, wg *sync.WaitGroup, sendDelay time.Duration) {
+func startTestClient(userName, queryParam, contentType, body string, currentClientNumber int, clientRandom *rand.Rand,
+	wg *sync.WaitGroup, thinkTime distribution) {
 	defer wg.Done()
 
+	liveMetrics.clientStarted()
+	defer liveMetrics.clientFinished()
+
 	for currentMessageNumber := 0; currentMessageNumber < testClientMessagesNum; currentMessageNumber++ {
-		responseStatusCode, responseBody := sendRequest("/", queryParam, contentType, body)
+		sendClientMessage(userName, queryParam, contentType, body, currentClientNumber, currentMessageNumber,
+			clientRandom, messageSchedule{expectedInterval: thinkTime.mean()})
 
-		atomic.AddUint32(&totalMessagesCount, 1)
+		time.Sleep(thinkTime.sample(clientRandom))
+	}
+}
 
-		if resultCheck := checkResponse(userName, responseBody, responseStatusCode, getExpectedGetItemsResponse); resultCheck != nil {
+// sendClientMessage sends one message of a client, clientRandom is the client's own source of randomness
+// because the shared one is not safe for concurrent use
+func sendClientMessage(userName, queryParam, contentType, body string, currentClientNumber, currentMessageNumber int,
+	clientRandom *rand.Rand, schedule messageSchedule) {
 
-			logError.Printf("[Goroutine %d][Message %d][Get Items Test] Got invalid response. "+
-				"Error Message: %s", currentClientNumber, currentMessageNumber, resultCheck)
+	if activeUserModel != nil {
+		activeUserModel.runSession(userName, contentType, currentClientNumber, currentMessageNumber, clientRandom, schedule)
+		return
+	}
+	if activeJourneys != nil {
+		activeJourneys.pick(clientRandom).run(userName, contentType, currentClientNumber, currentMessageNumber,
+			clientRandom, schedule)
+		return
+	}
 
-			muxGetItemsErrors.Lock()
-			getItemsErrors = append(getItemsErrors, *resultCheck)
-			muxGetItemsErrors.Unlock()
-		} else {
-			logInfo.Printf("[Goroutine %d][Message %d][Get Items Test] Got valid response. "+
-				"Testing buying of received items...", currentClientNumber, currentMessageNumber)
+	span := startRequestSpan("/", currentClientNumber, currentMessageNumber, 0)
+	result := sendRequest(requestParams{endpoint: "/", queryParams: queryParam, contentType: contentType, body: body},
+		schedule, span)
 
-			var parsedResponse = ResponseBody{}
-			json.Unmarshal([]byte(responseBody), &parsedResponse)
+	atomic.AddUint32(&currentPhaseStats.sentRequestsCount, 1)
 
-			items := parsedResponse.Items
+	resultCheck := checkResponse("/", userName, result, getExpectedGetItemsResponse)
+	span.end(resultCheck)
 
-			BuyItems(currentClientNumber, contentType, items)
-		}
+	if resultCheck != nil {
+
+		logError.Printf("[Goroutine %d][Message %d][Get Items Test] Got invalid response. "+
+			"Error Message: %s", currentClientNumber, currentMessageNumber, resultCheck)
+
+		currentPhaseStats.recordError("/", *resultCheck)
+		writeSample(sampleRecord{kind: sampleKindError, endpoint: "/", time: resultCheck.time,
+			errorClass: resultCheck.class, message: resultCheck.message, traceId: span.traceIdString()})
+	} else {
+		logInfo.Printf("[Goroutine %d][Message %d][Get Items Test] Got valid response. "+
+			"Testing buying of received items...", currentClientNumber, currentMessageNumber)
 
-		time.Sleep(sendDelay)
+		var parsedResponse = ResponseBody{}
+		json.Unmarshal([]byte(result.body), &parsedResponse)
+
+		items := parsedResponse.Items
+
+		BuyItems(currentClientNumber, currentMessageNumber, contentType, items, schedule)
 	}
 }
 
 func makeRequestParams(clientName string) (queryParams, contentType, requestBody string) {
 	availableContentTypes := []string{"application/x-www-form-urlencoded", "multipart/form-data"}
 
-	contentType = availableContentTypes[rand.Intn(len(availableContentTypes))]
+	contentType = availableContentTypes[random.Intn(len(availableContentTypes))]
 
 	if clientName != "" {
-		if rand.Intn(2) == 1 {
+		if random.Intn(2) == 1 {
 			queryParams = "name=" + clientName
 		}
 
@@ -354,299 +423,79 @@ func makeRequestParams(clientName string) (queryParams, contentType, requestBody
 	return
 }
 
-func main() {
-	Init()
-
-	defer logInfoOutfile.Close()
-	defer logErrorOutfile.Close()
-	defer logStatOutfile.Close()
-
-	//--------------------
-	//Warm Up A Test Ground
-	//--------------------
-
-	wgWarmUp := &sync.WaitGroup{}
-
-	testClientsNum = 10
-	testClientMessagesNum = 10
-
-	logStat.Print("Warm Up has started")
-
-	for currentClientNumber := 0; currentClientNumber < warmUpClientsNum; currentClientNumber++ {
-		wgWarmUp.Add(1)
-
-		currentClientName := requestClientNames[rand.Intn(len(requestClientNames))]
-
-		queryParams, contentType, requestBody := makeRequestParams(currentClientName)
-		sendDelay := time.Duration(time.Millisecond * 700)
-
-		go startTestClient(
-			currentClientName, queryParams, contentType, requestBody, currentClientNumber, wgWarmUp, sendDelay)
+func runScenario(scenario *Scenario) {
+	for _, phase := range scenario.Phases {
+		runPhase(phase)
 	}
-	wgWarmUp.Wait()
-
-	logStat.Print("[MAIN] Warm up is done")
-
-	resetTestGround()
-	//--------------------
-	//Load Tests with a large number of clients
-	//--------------------
+}
 
+func runPhase(phase Phase) {
 	wgTest := &sync.WaitGroup{}
 
-	testClientsNum = 10
-	testClientMessagesNum = 10
-
-	logStat.Print("[MAIN] Load tests with a large number of clients has been started")
+	testClientsNum = phase.Clients
+	testClientMessagesNum = phase.MessagesPerClient
 
-	for {
-		if testClientsNum >= testMaxClientsNum {
-			logStat.Printf("[MAIN] Reached clients limit. Stopping creating new clients...")
-			break
-		}
-		for currentClientNumber := 0; currentClientNumber < testClientsNum; currentClientNumber++ {
-			wgTest.Add(1)
+	phaseStartTime := time.Now()
+	startPhaseStats(phase.Name, phaseStartTime)
 
-			currentClientName := requestClientNames[rand.Intn(len(requestClientNames))]
+	logStat.Printf("[MAIN] %s has been started", phase.Name)
+	writeSample(sampleRecord{kind: sampleKindPhase, time: phaseStartTime, message: phase.Name})
 
-			queryParams, contentType, requestBody := makeRequestParams(currentClientName)
-			sendDelay := time.Duration(time.Millisecond * 700)
+	switch {
+	case phase.Executor == executorArrivalRate:
+		runArrivalRate(phase, wgTest)
+	case phase.RampStep > 0:
+		for {
+			if testClientsNum >= phase.MaxClients {
+				logStat.Printf("[MAIN] Reached clients limit. Stopping creating new clients...")
+				break
+			}
+			startTestClients(localWorker.share(testClientsNum), wgTest, phase.thinkTime())
 
-			go startTestClient(
-				currentClientName, queryParams, contentType, requestBody, currentClientNumber, wgTest, sendDelay)
+			time.Sleep(time.Duration(phase.RampInterval))
+			testClientsNum += phase.RampStep
+			logStat.Printf("[MAIN] New clients was added. Current clients number: %d", testClientsNum)
 		}
-		time.Sleep(5 * time.Second)
-		testClientsNum += 10
-		logStat.Printf("[MAIN] New clients was added. Current clients number: %d", testClientsNum)
-	}
-
-	wgTest.Wait()
-
-	//--------------------
-
-	logStat.Print("[MAIN] Load tests with a large number of clients has been done")
-	logStat.Print("[MAIN] Load tests with a large number of clients statistics:")
-	showStat()
-
-	resetTestGround()
-	//--------------------
-	//Load Tests with a large number of request from each client
-	//--------------------
-
-	testClientsNum = 4
-	testClientMessagesNum = 1000
-
-	logStat.Print("[MAIN] Load tests with a large number of requests from each client has been started")
-
-	for currentClientNumber := 0; currentClientNumber < testClientsNum; currentClientNumber++ {
-		wgTest.Add(1)
-
-		currentClientName := requestClientNames[rand.Intn(len(requestClientNames))]
-
-		queryParams, contentType, requestBody := makeRequestParams(currentClientName)
-		sendDelay := time.Duration(time.Millisecond * 200)
-
-		go startTestClient(
-			currentClientName, queryParams, contentType, requestBody, currentClientNumber, wgTest, sendDelay)
-	}
-
-	wgTest.Wait()
-
-	//--------------------
-
-	logStat.Print("[MAIN] Load tests with a large number of requests from each client has been done")
-	logStat.Print("[MAIN] Load tests with a large number of requests from each client statistics:")
-	showStat()
-}
-
-func resetTestGround() {
-	getItemsResponseTimeSlice = nil
-	buyItemsResponseTimeSlice = nil
-	getItemsErrors = nil
-	buyItemsErrors = nil
-	totalMessagesCount = 0
-}
-
-func showStat() {
-	logStat.Printf("Sent requests count: %d", totalMessagesCount)
-
-	logStat.Printf("Error statistics: "+
-		"%d errors occurred during get items tests, %d errors occurred during buy items tests",
-		len(getItemsErrors), len(buyItemsErrors))
-
-	var allRequestsTimeSlice []ResponseTime
-	allRequestsTimeSlice = append(allRequestsTimeSlice, getItemsResponseTimeSlice...)
-	allRequestsTimeSlice = append(allRequestsTimeSlice, buyItemsResponseTimeSlice...)
-
-	logStat.Print("General requests statistics:")
-	showResponseTimeSliceStat(allRequestsTimeSlice)
-}
-
-func showResponseTimeSliceStat(timeSlice []ResponseTime) {
-	averageResponseTime := findAverageResponseTime(timeSlice).Seconds() * 1000
-	logStat.Printf("Average response time:	%f ms", averageResponseTime)
-
-	responseTimeMedian := findTimeMedian(timeSlice).Seconds() * 1000
-	logStat.Printf("Response time median:	%f ms", responseTimeMedian)
-
-	timePercentile95Value := findTimePercentile(timeSlice, 95).Seconds() * 1000
-	logStat.Printf("Response time 95th percentile:	%f ms", timePercentile95Value)
-
-	showRequestsNumTimeDependency(timeSlice)
-	showRequestsNumClientsNumDependency(timeSlice)
-	showResponseTimeClientsNumDependency(timeSlice)
-}
-
-func showRequestsNumTimeDependency(timeSlice []ResponseTime) {
-	sort.Slice(timeSlice,
-		func(i, j int) bool {
-			return timeSlice[i].timeWhileSendingRequest.Before(timeSlice[j].timeWhileSendingRequest)
-		})
-
-	timeRequestsNumStat := make(map[time.Time]int)
-
-	intervalStartTime := timeSlice[0].timeWhileSendingRequest
-	intervalTimeStep := time.Duration(time.Second)
-	requestsCount := 0
-	for _, currentClientTimeStat := range timeSlice {
-		if currentClientTimeStat.timeWhileSendingRequest.Sub(intervalStartTime) >= intervalTimeStep {
-			timeRequestsNumStat[currentClientTimeStat.timeWhileSendingRequest] = requestsCount
-			intervalStartTime = currentClientTimeStat.timeWhileSendingRequest
+	default:
+		if phase.ClientsLabel > 0 {
+			testClientsNum = phase.ClientsLabel
 		}
-		requestsCount++
+		startTestClients(localWorker.share(phase.Clients), wgTest, phase.thinkTime())
 	}
-	timeRequestsNumStat[timeSlice[len(timeSlice)-1].timeWhileSendingRequest] = requestsCount
 
-	mapTimeKeys := make([]time.Time, 0)
-	for currentTimeKey := range timeRequestsNumStat {
-		mapTimeKeys = append(mapTimeKeys, currentTimeKey)
-	}
-	sort.Slice(mapTimeKeys,
-		func(i, j int) bool { return mapTimeKeys[i].Before(mapTimeKeys[j]) })
-
-	logStat.Print("Statistics of the number of requests in a certain time:")
-	logStat.Print("Time	Number of requests")
-	for _, currentTime := range mapTimeKeys {
-		logStat.Print(currentTime.Format("15:04:05") + "	" + strconv.Itoa(timeRequestsNumStat[currentTime]))
-	}
-}
-
-func showRequestsNumClientsNumDependency(timeSlice []ResponseTime) {
-	sort.Slice(timeSlice,
-		func(i, j int) bool {
-			return timeSlice[i].timeWhileSendingRequest.Before(timeSlice[j].timeWhileSendingRequest)
-		})
-
-	timeClientsRequestsStat := make(map[int]int)
-
-	intervalStartClientsNum := timeSlice[0].clientsNum
-	requestsCount := 0
-	for _, currentClientTimeStat := range timeSlice {
-		if currentClientTimeStat.clientsNum != intervalStartClientsNum {
-			timeClientsRequestsStat[currentClientTimeStat.clientsNum] = requestsCount
-			intervalStartClientsNum = currentClientTimeStat.clientsNum
-		}
-		requestsCount++
-	}
-	timeClientsRequestsStat[timeSlice[len(timeSlice)-1].clientsNum] = requestsCount
+	wgTest.Wait()
 
-	mapClientsNumKeys := make([]int, 0)
-	for currentClientsNumKey := range timeClientsRequestsStat {
-		mapClientsNumKeys = append(mapClientsNumKeys, currentClientsNumKey)
-	}
-	sort.Slice(mapClientsNumKeys,
-		func(i, j int) bool { return mapClientsNumKeys[i] < mapClientsNumKeys[j] })
+	currentPhaseStats.endTime = time.Now()
 
-	logStat.Print("Statistics of the number of requests at a certain number of clients:")
-	logStat.Print("Clients	Number of requests")
-	for _, currentClientsNum := range mapClientsNumKeys {
-		logStat.Printf("%d	%d", currentClientsNum, timeClientsRequestsStat[currentClientsNum])
-	}
+	finishPhase(phase)
 }
 
-func showResponseTimeClientsNumDependency(timeSlice []ResponseTime) {
-	sort.Slice(timeSlice,
-		func(i, j int) bool {
-			return timeSlice[i].timeWhileSendingRequest.Before(timeSlice[j].timeWhileSendingRequest)
-		})
+func finishPhase(phase Phase) {
+	currentPhaseStats.showStat = phase.ShowStat
 
-	averageResponseTimeStat := make(map[int]time.Duration)
-	responseTimeMedianStat := make(map[int]time.Duration)
-	response95thPercentileStat := make(map[int]time.Duration)
+	logStat.Printf("[MAIN] %s has been done", phase.Name)
+	writeSample(sampleRecord{kind: sampleKindDone, time: currentPhaseStats.endTime, message: phase.Name})
 
-	intervalStartClientsNum := timeSlice[0].clientsNum
-	for index, currentClientTimeStat := range timeSlice {
-		if currentClientTimeStat.clientsNum != intervalStartClientsNum {
-			currentAverageResponseTime := findAverageResponseTime(timeSlice[:index+1])
-			currentTimeMedian := findTimeMedian(timeSlice[:index+1])
-			current95thPercentile := findTimePercentile(timeSlice[:index+1], 95)
+	if phase.ShowStat {
+		writeSample(sampleRecord{kind: sampleKindStat, time: time.Now(), message: phase.Name})
 
-			responseTimeMedianStat[currentClientTimeStat.clientsNum] = currentTimeMedian
-			averageResponseTimeStat[currentClientTimeStat.clientsNum] = currentAverageResponseTime
-			response95thPercentileStat[currentClientTimeStat.clientsNum] = current95thPercentile
-
-			intervalStartClientsNum = currentClientTimeStat.clientsNum
+		if reportFormats["text"] {
+			logStat.Printf("[MAIN] %s statistics:", phase.Name)
+			showStat()
 		}
 	}
-	averageResponseTimeStat[timeSlice[len(timeSlice)-1].clientsNum] = findAverageResponseTime(timeSlice)
-	responseTimeMedianStat[timeSlice[len(timeSlice)-1].clientsNum] = findTimeMedian(timeSlice)
-	response95thPercentileStat[timeSlice[len(timeSlice)-1].clientsNum] = findTimePercentile(timeSlice, 95)
-
-	mapClientsNumKeys := make([]int, 0)
-	for currentClientsNumKey := range averageResponseTimeStat {
-		mapClientsNumKeys = append(mapClientsNumKeys, currentClientsNumKey)
-	}
-	sort.Slice(mapClientsNumKeys,
-		func(i, j int) bool { return mapClientsNumKeys[i] < mapClientsNumKeys[j] })
-
-	logStat.Print("Average response time statistics at a certain number of clients:")
-	logStat.Print("Clients	Average response time in ms")
-	for _, currentClientsNum := range mapClientsNumKeys {
-		logStat.Printf("%d	%f",
-			currentClientsNum, averageResponseTimeStat[currentClientsNum].Seconds()*1000)
-	}
-
-	logStat.Print("Response time median statistics at a certain number of clients:")
-	logStat.Print("Clients	Response time median in ms")
-	for _, currentClientsNum := range mapClientsNumKeys {
-		logStat.Printf("%d	%f",
-			currentClientsNum, responseTimeMedianStat[currentClientsNum].Seconds()*1000)
-	}
-
-	logStat.Print("Response time 95th percentile at a certain number of clients:")
-	logStat.Print("Clients	Response time 95th percentile in ms")
-	for _, currentClientsNum := range mapClientsNumKeys {
-		logStat.Printf("%d	%f",
-			currentClientsNum, response95thPercentileStat[currentClientsNum].Seconds()*1000)
-	}
-}
-
-func findTimePercentile(timeSlice []ResponseTime, percentile float32) time.Duration {
-	sort.Slice(timeSlice,
-		func(i, j int) bool { return timeSlice[i].elapsedTime < timeSlice[j].elapsedTime })
-
-	percentileValuePosition := int(percentile/100*float32(len(timeSlice))+0.5) - 1
-
-	return timeSlice[percentileValuePosition].elapsedTime
 }
 
-func findTimeMedian(timeSlice []ResponseTime) time.Duration {
-	sort.Slice(timeSlice,
-		func(i, j int) bool { return timeSlice[i].elapsedTime < timeSlice[j].elapsedTime })
+func startTestClients(clientsNum int, wg *sync.WaitGroup, thinkTime distribution) {
+	for currentClientNumber := 0; currentClientNumber < clientsNum; currentClientNumber++ {
+		wg.Add(1)
 
-	if len(timeSlice)%2 != 0 {
-		return timeSlice[(len(timeSlice)+1)/2].elapsedTime
-	} else {
-		return (timeSlice[len(timeSlice)/2].elapsedTime + timeSlice[len(timeSlice)/2+1].elapsedTime) / 2
-	}
-}
+		currentClientName := requestClientNames[random.Intn(len(requestClientNames))]
 
-func findAverageResponseTime(timeSlice []ResponseTime) time.Duration {
-	var totalTime time.Duration
+		queryParams, contentType, requestBody := makeRequestParams(currentClientName)
+		clientRandom := rand.New(rand.NewSource(random.Int63()))
 
-	for _, currentResponseTime := range timeSlice {
-		totalTime += currentResponseTime.elapsedTime
+		go startTestClient(currentClientName, queryParams, contentType, requestBody, currentClientNumber, clientRandom,
+			wg, thinkTime)
 	}
-
-	return totalTime / time.Duration(len(timeSlice))
 }
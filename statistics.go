@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var reportPercentiles = []float64{50, 90, 95, 99, 99.9}
+
+const bytesInMegabyte = 1000 * 1000
+
+func parsePercentiles(value string) ([]float64, error) {
+	uniquePercentiles := make(map[float64]bool)
+
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		percentile, err := strconv.ParseFloat(field, 64)
+		if err != nil || percentile <= 0 || percentile > 100 {
+			return nil, fmt.Errorf("invalid percentile %q: a number in (0, 100] is expected", field)
+		}
+		uniquePercentiles[percentile] = true
+	}
+
+	if len(uniquePercentiles) == 0 {
+		return nil, errors.New("at least one percentile is required")
+	}
+
+	percentiles := make([]float64, 0, len(uniquePercentiles))
+	for percentile := range uniquePercentiles {
+		percentiles = append(percentiles, percentile)
+	}
+	sort.Float64s(percentiles)
+	return percentiles, nil
+}
+
+func percentileName(percentile float64) string {
+	name := strconv.FormatFloat(percentile, 'f', -1, 64)
+
+	switch {
+	case strings.HasSuffix(name, "11"), strings.HasSuffix(name, "12"), strings.HasSuffix(name, "13"):
+		return name + "th"
+	case strings.HasSuffix(name, "1"):
+		return name + "st"
+	case strings.HasSuffix(name, "2"):
+		return name + "nd"
+	case strings.HasSuffix(name, "3"):
+		return name + "rd"
+	}
+	return name + "th"
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return duration.Seconds() * 1000
+}
+
+func formatPercentiles(percentiles []float64) string {
+	fields := make([]string, len(percentiles))
+	for index, percentile := range percentiles {
+		fields[index] = strconv.FormatFloat(percentile, 'f', -1, 64)
+	}
+	return strings.Join(fields, ",")
+}
+
+func percentileLabel(percentile float64) string {
+	if percentile == 50 {
+		return "median"
+	}
+	return percentileName(percentile) + " percentile"
+}
+
+func showStat() {
+	logStat.Printf("Sent requests count: %d", atomic.LoadUint32(&currentPhaseStats.sentRequestsCount))
+
+	logStat.Printf("Error statistics: "+
+		"%d errors occurred during get items tests, %d errors occurred during buy items tests",
+		currentPhaseStats.endpoint("/").errorsCount(), currentPhaseStats.endpoint("/buy").errorsCount())
+
+	showErrorClassesStat(currentPhaseStats)
+
+	if droppedIterationsCount := atomic.LoadUint32(&currentPhaseStats.droppedIterationsCount); droppedIterationsCount > 0 {
+		logStat.Printf("Dropped iterations: %d", droppedIterationsCount)
+	}
+
+	showJourneyStat(currentPhaseStats)
+	showUserStateStat(currentPhaseStats)
+
+	allRequestsStats := currentPhaseStats.allEndpoints()
+
+	logStat.Print("General requests statistics:")
+	showCorrectedResponseTimeStat(allRequestsStats.responseTime, allRequestsStats.correctedResponseTime)
+	showConnectionStat(allRequestsStats.connection)
+	showTransferStat(currentPhaseStats, allRequestsStats)
+	showResponseTimeStat(allRequestsStats)
+}
+
+func showTransferStat(stats *phaseStats, allRequestsStats *endpointStats) {
+	logStat.Print("Transfer statistics:")
+	logStat.Print("Endpoint	Bytes sent	Bytes received	Sent MB/s	Received MB/s")
+
+	showTransfer := func(endpoint string, transfer transferReport) {
+		logStat.Printf("%s	%d	%d	%f	%f", endpoint,
+			transfer.BytesSent, transfer.BytesReceived, transfer.SentMBPerSecond, transfer.ReceivedMBPerSecond)
+	}
+
+	duration := stats.duration()
+	for _, endpoint := range stats.endpointNames() {
+		showTransfer(endpoint, stats.endpoint(endpoint).transferReport(duration))
+	}
+	showTransfer("all", allRequestsStats.transferReport(duration))
+}
+
+func showResponseTimeStat(stats *endpointStats) {
+	if stats.responseTime.count() == 0 {
+		logStat.Print("No responses were received")
+		return
+	}
+
+	logStat.Printf("Average response time:	%f ms", milliseconds(stats.responseTime.mean()))
+
+	for _, percentile := range reportPercentiles {
+		logStat.Printf("Response time %s:	%f ms",
+			percentileLabel(percentile), milliseconds(stats.responseTime.valueAtPercentile(percentile)))
+	}
+	logStat.Printf("Max response time:	%f ms", milliseconds(stats.responseTime.max()))
+
+	showRequestsNumTimeDependency(stats.requestsNum)
+	showRequestsNumClientsNumDependency(stats.clientsNumResponseTime)
+	showResponseTimeClientsNumDependency(stats.clientsNumResponseTime)
+}
+
+func showRequestsNumTimeDependency(requestsNum *timeSeries) {
+	logStat.Print("Statistics of the number of requests in a certain time:")
+	logStat.Print("Time	Number of requests")
+
+	var requestsCount uint64
+	for second, secondRequestsCount := range requestsNum.values() {
+		if secondRequestsCount == 0 {
+			continue
+		}
+		requestsCount += secondRequestsCount
+
+		currentTime := requestsNum.startTime.Add(time.Duration(second+1) * time.Second)
+		logStat.Print(currentTime.Format("15:04:05") + "	" + strconv.FormatUint(requestsCount, 10))
+	}
+}
+
+func showRequestsNumClientsNumDependency(levels *clientsNumHistograms) {
+	logStat.Print("Statistics of the number of requests at a certain number of clients:")
+	logStat.Print("Clients	Number of requests")
+
+	for _, currentClientsNum := range levels.clientsNums() {
+		logStat.Printf("%d	%d", currentClientsNum, levels.get(currentClientsNum).count())
+	}
+}
+
+// showResponseTimeClientsNumDependency prints the response time of the requests that were sent while
+// a certain number of clients was running, every number of clients is computed on its own requests only
+func showResponseTimeClientsNumDependency(levels *clientsNumHistograms) {
+	clientsNums := levels.clientsNums()
+
+	logStat.Print("Average response time statistics at a certain number of clients:")
+	logStat.Print("Clients	Average response time in ms")
+	for _, currentClientsNum := range clientsNums {
+		logStat.Printf("%d	%f", currentClientsNum, milliseconds(levels.get(currentClientsNum).mean()))
+	}
+
+	for _, percentile := range reportPercentiles {
+		if percentile == 50 {
+			logStat.Print("Response time median statistics at a certain number of clients:")
+		} else {
+			logStat.Printf("Response time %s at a certain number of clients:", percentileLabel(percentile))
+		}
+		logStat.Printf("Clients	Response time %s in ms", percentileLabel(percentile))
+
+		for _, currentClientsNum := range clientsNums {
+			logStat.Printf("%d	%f",
+				currentClientsNum, milliseconds(levels.get(currentClientsNum).valueAtPercentile(percentile)))
+		}
+	}
+
+	logStat.Print("Max response time statistics at a certain number of clients:")
+	logStat.Print("Clients	Max response time in ms")
+	for _, currentClientsNum := range clientsNums {
+		logStat.Printf("%d	%f", currentClientsNum, milliseconds(levels.get(currentClientsNum).max()))
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const statsdMaxPacketBytes = 1432
+
+// statsdSink emits a request counter and a response time timer per request over StatsD UDP. Counters
+// are summed between flushes, timers are sampled at sampleRate into a histogram per flush, so the memory
+// use does not grow with the request rate. DogStatsD tags the metrics with the endpoint, content type,
+// status code and phase and packs the timer values of a series into multi-value lines; plain StatsD puts
+// the tags into the name and sends a line per value.
+type statsdSink struct {
+	prefix     string
+	dogStatsd  bool
+	sampleRate float64
+	conn       net.Conn
+
+	mux      sync.Mutex
+	random   *rand.Rand
+	counters map[metricSeriesKey]uint64
+	timers   map[metricSeriesKey]*histogram
+}
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", ":", "_", "\n", "_")
+
+func newStatsdSink(address, prefix string, dogStatsd bool, sampleRate float64, seed int64) (*statsdSink, error) {
+	if sampleRate <= 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("StatsD sample rate must be in (0, 1], got %g", sampleRate)
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open StatsD UDP socket: %s", err)
+	}
+
+	return &statsdSink{
+		prefix:     strings.Trim(prefix, "."),
+		dogStatsd:  dogStatsd,
+		sampleRate: sampleRate,
+		conn:       conn,
+		random:     rand.New(rand.NewSource(seed)),
+		counters:   make(map[metricSeriesKey]uint64),
+		timers:     make(map[metricSeriesKey]*histogram),
+	}, nil
+}
+
+func (sink *statsdSink) name() string {
+	return "StatsD " + sink.conn.RemoteAddr().String()
+}
+
+func (sink *statsdSink) record(metric requestMetric) {
+	key := metricSeriesKey{phase: metric.phase, endpoint: metric.endpoint, encoding: metric.encoding, status: metric.status()}
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	sink.counters[key]++
+	if metric.statusCode <= 0 || (sink.sampleRate < 1 && sink.random.Float64() >= sink.sampleRate) {
+		return
+	}
+
+	timer, ok := sink.timers[key]
+	if !ok {
+		timer = newHistogram(clientsNumHistogramSignificantDigits)
+		sink.timers[key] = timer
+	}
+	timer.record(metric.elapsedTime)
+}
+
+func (sink *statsdSink) metricName(metric string, key metricSeriesKey) string {
+	name := []string{metric}
+	if sink.prefix != "" {
+		name = append([]string{sink.prefix}, name...)
+	}
+
+	if !sink.dogStatsd {
+		if key.phase != "" {
+			name = append(name, graphiteNode(key.phase))
+		}
+		name = append(name, graphiteNode(key.endpoint), graphiteNode(key.encoding), graphiteNode(key.status))
+	}
+
+	return strings.Join(name, ".")
+}
+
+func (sink *statsdSink) tags(key metricSeriesKey) string {
+	if !sink.dogStatsd {
+		return ""
+	}
+
+	tags := []string{
+		"endpoint:" + statsdTagReplacer.Replace(key.endpoint),
+		"content_type:" + statsdTagReplacer.Replace(key.encoding),
+		"status:" + key.status,
+	}
+	if key.phase != "" {
+		tags = append(tags, "phase:"+statsdTagReplacer.Replace(key.phase))
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+func sortedMetricSeriesKeys(counters map[metricSeriesKey]uint64) []metricSeriesKey {
+	keys := make([]metricSeriesKey, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.phase != b.phase {
+			return a.phase < b.phase
+		}
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		if a.encoding != b.encoding {
+			return a.encoding < b.encoding
+		}
+		return a.status < b.status
+	})
+	return keys
+}
+
+// timerLines writes the values of a timer from the lowest, each value as many times as it was recorded.
+// A value is the lowest value equivalent to its histogram bucket, clamped to the recorded minimum, so a
+// value that starts its bucket, such as a response time of 2ms, is sent as it was recorded.
+func (sink *statsdSink) timerLines(key metricSeriesKey, timer *histogram) []string {
+	name, suffix := sink.metricName("response_time", key), "|ms"
+	if sink.sampleRate < 1 {
+		suffix += "|@" + strconv.FormatFloat(sink.sampleRate, 'f', -1, 64)
+	}
+	suffix += sink.tags(key)
+
+	var lines []string
+	line := &strings.Builder{}
+	snapshot := timer.snapshot()
+	for position, index := range snapshot.Indexes {
+		value := timer.lowestEquivalentValue(index)
+		if value < snapshot.MinValue {
+			value = snapshot.MinValue
+		}
+		formattedValue := metricField{value: milliseconds(histogramValueToDuration(value))}.format()
+
+		for count := snapshot.Counts[position]; count > 0; count-- {
+			if line.Len() > 0 && (!sink.dogStatsd || line.Len()+1+len(formattedValue)+len(suffix) > statsdMaxPacketBytes) {
+				lines = append(lines, line.String()+suffix)
+				line.Reset()
+			}
+			if line.Len() == 0 {
+				line.WriteString(name)
+			}
+			line.WriteString(":" + formattedValue)
+		}
+	}
+	if line.Len() > 0 {
+		lines = append(lines, line.String()+suffix)
+	}
+	return lines
+}
+
+func (sink *statsdSink) flush(flushTime time.Time) error {
+	sink.mux.Lock()
+	counters, timers := sink.counters, sink.timers
+	sink.counters = make(map[metricSeriesKey]uint64)
+	sink.timers = make(map[metricSeriesKey]*histogram)
+	sink.mux.Unlock()
+
+	// Every sampled timer has a counter, so the counters list all the series
+	var lines []string
+	for _, key := range sortedMetricSeriesKeys(counters) {
+		lines = append(lines, fmt.Sprintf("%s:%d|c%s", sink.metricName("requests", key), counters[key], sink.tags(key)))
+		if timer, ok := timers[key]; ok {
+			lines = append(lines, sink.timerLines(key, timer)...)
+		}
+	}
+
+	packet := &bytes.Buffer{}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsdMaxPacketBytes {
+			if _, err := sink.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		_, err := sink.conn.Write(packet.Bytes())
+		return err
+	}
+	return nil
+}
+
+func (sink *statsdSink) close() error {
+	return sink.conn.Close()
+}
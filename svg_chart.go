@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+)
+
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+type chartPoint struct {
+	x, y float64
+}
+
+type chartSeries struct {
+	name   string
+	points []chartPoint
+}
+
+// lineChart renders series of points as an inline SVG line chart with a zero-based y axis
+type lineChart struct {
+	title       string
+	xLabel      string
+	yLabel      string
+	formatXTick func(x float64) string
+	series      []chartSeries
+}
+
+const (
+	chartWidth        = 760
+	chartHeight       = 320
+	chartMarginLeft   = 70
+	chartMarginRight  = 20
+	chartMarginTop    = 40
+	chartMarginBottom = 50
+	chartTicksNum     = 5
+)
+
+func niceTickStep(valueRange float64) float64 {
+	if valueRange <= 0 {
+		return 1
+	}
+
+	roughStep := valueRange / chartTicksNum
+	magnitude := math.Pow(10, math.Floor(math.Log10(roughStep)))
+	for _, multiplier := range []float64{1, 2, 5, 10} {
+		if step := multiplier * magnitude; step >= roughStep {
+			return step
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatChartNumber(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", value), "0"), ".")
+}
+
+func (chart lineChart) render() template.HTML {
+	svg := &strings.Builder{}
+	fmt.Fprintf(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(svg, `<text x="%d" y="20" font-size="14" font-weight="bold">%s</text>`, chartMarginLeft, html.EscapeString(chart.title))
+
+	minX, maxX, maxY := math.Inf(1), math.Inf(-1), 0.0
+	for _, series := range chart.series {
+		for _, point := range series.points {
+			minX, maxX, maxY = math.Min(minX, point.x), math.Max(maxX, point.x), math.Max(maxY, point.y)
+		}
+	}
+
+	plotWidth := float64(chartWidth - chartMarginLeft - chartMarginRight)
+	plotHeight := float64(chartHeight - chartMarginTop - chartMarginBottom)
+
+	if math.IsInf(minX, 1) {
+		fmt.Fprintf(svg, `<text x="%d" y="%d" fill="#777">No data</text></svg>`, chartWidth/2-20, chartHeight/2)
+		return template.HTML(svg.String())
+	}
+	if maxX == minX {
+		minX, maxX = minX-1, maxX+1
+	}
+
+	yStep := niceTickStep(maxY)
+	maxY = math.Max(yStep, math.Ceil(maxY/yStep)*yStep)
+
+	scaleX := func(x float64) float64 { return chartMarginLeft + (x-minX)/(maxX-minX)*plotWidth }
+	scaleY := func(y float64) float64 { return chartMarginTop + plotHeight - y/maxY*plotHeight }
+
+	for y := 0.0; y <= maxY+yStep/2; y += yStep {
+		fmt.Fprintf(svg, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`,
+			chartMarginLeft, scaleY(y), chartMarginLeft+plotWidth, scaleY(y))
+		fmt.Fprintf(svg, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`,
+			chartMarginLeft-6, scaleY(y)+4, formatChartNumber(y))
+	}
+
+	xStep := niceTickStep(maxX - minX)
+	for x := math.Ceil(minX/xStep) * xStep; x <= maxX; x += xStep {
+		label := formatChartNumber(x)
+		if chart.formatXTick != nil {
+			label = chart.formatXTick(x)
+		}
+		fmt.Fprintf(svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#999"/>`,
+			scaleX(x), chartMarginTop+plotHeight, scaleX(x), chartMarginTop+plotHeight+4)
+		fmt.Fprintf(svg, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`,
+			scaleX(x), chartMarginTop+plotHeight+16, html.EscapeString(label))
+	}
+
+	fmt.Fprintf(svg, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" stroke="#999"/>`,
+		chartMarginLeft, chartMarginTop, plotWidth, plotHeight)
+	fmt.Fprintf(svg, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`,
+		chartMarginLeft+plotWidth/2, chartHeight-8, html.EscapeString(chart.xLabel))
+	fmt.Fprintf(svg, `<text transform="translate(14 %.1f) rotate(-90)" text-anchor="middle">%s</text>`,
+		chartMarginTop+plotHeight/2, html.EscapeString(chart.yLabel))
+
+	for seriesIndex, series := range chart.series {
+		color := chartColors[seriesIndex%len(chartColors)]
+
+		coordinates := make([]string, len(series.points))
+		for pointIndex, point := range series.points {
+			coordinates[pointIndex] = fmt.Sprintf("%.1f,%.1f", scaleX(point.x), scaleY(point.y))
+		}
+		fmt.Fprintf(svg, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`,
+			color, strings.Join(coordinates, " "))
+		if len(series.points) <= 60 {
+			for _, point := range series.points {
+				fmt.Fprintf(svg, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="%s"/>`, scaleX(point.x), scaleY(point.y), color)
+			}
+		}
+
+		legendX := chartMarginLeft + 10 + seriesIndex*130
+		fmt.Fprintf(svg, `<rect x="%d" y="27" width="10" height="3" fill="%s"/>`, legendX, color)
+		fmt.Fprintf(svg, `<text x="%d" y="32">%s</text>`, legendX+14, html.EscapeString(series.name))
+	}
+
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
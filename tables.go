@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// statisticTable is one of the tables of Stat.log, such as clients vs median response time. Tables
+// with rowLabels have a text first column, such as the endpoint of the transfer table.
+type statisticTable struct {
+	phaseNumber int
+	phaseName   string
+	statistic   string
+	header      []string
+	rowLabels   []string
+	rows        [][]float64
+}
+
+func reportTables(report *runReport) []statisticTable {
+	tables := append(clientsNumTables(report), transferTables(report)...)
+	tables = append(tables, journeyTables(report)...)
+	return append(tables, userStateTables(report)...)
+}
+
+func clientsNumTables(report *runReport) []statisticTable {
+	var tables []statisticTable
+
+	for phaseIndex, phase := range report.Phases {
+		if !phase.ShowStat {
+			continue
+		}
+
+		newTable := func(statistic, valueHeader string, value func(level clientsNumReport) float64) {
+			table := statisticTable{
+				phaseNumber: phaseIndex + 1,
+				phaseName:   phase.Name,
+				statistic:   statistic,
+				header:      []string{"Clients", valueHeader},
+			}
+			for _, level := range phase.AllRequests.ClientsNum {
+				table.rows = append(table.rows, []float64{float64(level.Clients), value(level)})
+			}
+			tables = append(tables, table)
+		}
+
+		newTable("Requests", "Number of requests", func(level clientsNumReport) float64 {
+			return float64(level.Requests)
+		})
+		newTable("Average", "Average response time in ms", func(level clientsNumReport) float64 {
+			return level.Latency.MeanMs
+		})
+		for _, percentile := range report.Metadata.Percentiles {
+			key := percentileKey(percentile)
+			label := percentileLabel(percentile)
+			newTable(strings.ToUpper(label[:1])+label[1:], "Response time "+label+" in ms", func(level clientsNumReport) float64 {
+				return level.Latency.Percentiles[key]
+			})
+		}
+		newTable("Max", "Max response time in ms", func(level clientsNumReport) float64 {
+			return level.Latency.MaxMs
+		})
+	}
+
+	return tables
+}
+
+func transferTables(report *runReport) []statisticTable {
+	var tables []statisticTable
+
+	for phaseIndex, phase := range report.Phases {
+		if !phase.ShowStat {
+			continue
+		}
+
+		table := statisticTable{
+			phaseNumber: phaseIndex + 1,
+			phaseName:   phase.Name,
+			statistic:   "Transfer",
+			header:      []string{"Endpoint", "Bytes sent", "Bytes received", "Sent MB/s", "Received MB/s"},
+		}
+		endpoints := append([]endpointReport(nil), phase.Endpoints...)
+		for _, endpoint := range append(endpoints, phase.AllRequests) {
+			table.rowLabels = append(table.rowLabels, endpoint.Endpoint)
+			table.rows = append(table.rows, []float64{
+				float64(endpoint.Transfer.BytesSent), float64(endpoint.Transfer.BytesReceived),
+				endpoint.Transfer.SentMBPerSecond, endpoint.Transfer.ReceivedMBPerSecond,
+			})
+		}
+		tables = append(tables, table)
+	}
+
+	return tables
+}
+
+func journeyTables(report *runReport) []statisticTable {
+	var tables []statisticTable
+
+	for phaseIndex, phase := range report.Phases {
+		if !phase.ShowStat || len(phase.Journeys) == 0 {
+			continue
+		}
+
+		table := statisticTable{
+			phaseNumber: phaseIndex + 1,
+			phaseName:   phase.Name,
+			statistic:   "Journeys",
+			header:      []string{"Journey", "Runs", "Share in %", "Completed", "Failed", "Average duration in ms"},
+		}
+		for _, percentile := range report.Metadata.Percentiles {
+			table.header = append(table.header, "Duration "+percentileLabel(percentile)+" in ms")
+		}
+		for _, journey := range phase.Journeys {
+			row := []float64{float64(journey.Runs), journey.SharePercent, float64(journey.Completed),
+				float64(journey.Failed), journey.Duration.MeanMs}
+			for _, percentile := range report.Metadata.Percentiles {
+				row = append(row, journey.Duration.Percentiles[percentileKey(percentile)])
+			}
+			table.rowLabels = append(table.rowLabels, journey.Name)
+			table.rows = append(table.rows, row)
+		}
+		tables = append(tables, table)
+	}
+
+	return tables
+}
+
+func userStateTables(report *runReport) []statisticTable {
+	var tables []statisticTable
+
+	for phaseIndex, phase := range report.Phases {
+		if !phase.ShowStat || len(phase.UserStates) == 0 {
+			continue
+		}
+
+		table := statisticTable{
+			phaseNumber: phaseIndex + 1,
+			phaseName:   phase.Name,
+			statistic:   "States",
+			header:      []string{"State", "Visits", "Share of visits in %", "Failed", "Average latency in ms"},
+		}
+		for _, percentile := range report.Metadata.Percentiles {
+			table.header = append(table.header, "Latency "+percentileLabel(percentile)+" in ms")
+		}
+		table.header = append(table.header, "Average dwell time in ms", "Max dwell time in ms")
+		for _, state := range phase.UserStates {
+			row := []float64{float64(state.Visits), state.SharePercent, float64(state.Failed), state.Latency.MeanMs}
+			for _, percentile := range report.Metadata.Percentiles {
+				row = append(row, state.Latency.Percentiles[percentileKey(percentile)])
+			}
+			row = append(row, state.DwellTime.MeanMs, state.DwellTime.MaxMs)
+			table.rowLabels = append(table.rowLabels, state.Name)
+			table.rows = append(table.rows, row)
+		}
+		tables = append(tables, table)
+	}
+
+	return tables
+}
+
+func (table statisticTable) fileName() string {
+	return fmt.Sprintf("Phase%d-%s.csv", table.phaseNumber, strings.Replace(strings.ToLower(table.statistic), " ", "-", -1))
+}
+
+func formatTableValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func writeCsvReport(report *runReport, reportDir string) error {
+	csvDir := filepath.Join(reportDir, "Report-csv")
+	if err := os.MkdirAll(csvDir, 0755); err != nil {
+		return err
+	}
+
+	staleTables, _ := filepath.Glob(filepath.Join(csvDir, "Phase*.csv"))
+	for _, staleTable := range staleTables {
+		os.Remove(staleTable)
+	}
+
+	for _, table := range reportTables(report) {
+		if err := writeCsvTable(filepath.Join(csvDir, table.fileName()), table); err != nil {
+			return err
+		}
+	}
+
+	logStat.Printf("[MAIN] CSV report has been written to %s", csvDir)
+	return nil
+}
+
+func writeCsvTable(path string, table statisticTable) error {
+	outfile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(outfile)
+	writer.Write(table.header)
+	for rowIndex, row := range table.rows {
+		var fields []string
+		if table.rowLabels != nil {
+			fields = append(fields, table.rowLabels[rowIndex])
+		}
+		for _, value := range row {
+			fields = append(fields, formatTableValue(value))
+		}
+		writer.Write(fields)
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		outfile.Close()
+		return err
+	}
+	return outfile.Close()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	otlpBatchSize     = 512
+	otlpFlushInterval = 2 * time.Second
+	otlpQueueSize     = 16 * otlpBatchSize
+
+	otlpSpanKindClient  = 3
+	otlpStatusCodeOk    = 1
+	otlpStatusCodeError = 2
+)
+
+// requestSpan is the trace span of one request. Its W3C traceparent header lets a slow request of the
+// load report be found among the server-side traces. The span is exported once the response is validated.
+type requestSpan struct {
+	traceId [16]byte
+	spanId  [8]byte
+
+	phase         string
+	endpoint      string
+	method        string
+	url           string
+	clientNumber  int
+	messageNumber int
+	itemNumber    int
+
+	startTime  time.Time
+	endTime    time.Time
+	statusCode int
+	sendError  string
+}
+
+func startRequestSpan(endpoint string, clientNumber, messageNumber, itemNumber int) *requestSpan {
+	span := &requestSpan{
+		phase:         currentPhaseStats.name,
+		endpoint:      endpoint,
+		clientNumber:  clientNumber,
+		messageNumber: messageNumber,
+		itemNumber:    itemNumber,
+	}
+	cryptorand.Read(span.traceId[:])
+	cryptorand.Read(span.spanId[:])
+	return span
+}
+
+func (span *requestSpan) traceIdString() string {
+	return hex.EncodeToString(span.traceId[:])
+}
+
+func (span *requestSpan) traceparent() string {
+	return "00-" + span.traceIdString() + "-" + hex.EncodeToString(span.spanId[:]) + "-01"
+}
+
+// end completes the span with the validation result of the response, nil when it is valid
+func (span *requestSpan) end(validationError *ErrResponse) {
+	if spanExporter == nil {
+		return
+	}
+	spanExporter.export(span.otlpSpan(validationError))
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int) otlpAttribute {
+	formattedValue := strconv.Itoa(value)
+	return otlpAttribute{Key: key, Value: otlpAnyValue{IntValue: &formattedValue}}
+}
+
+func (span *requestSpan) otlpSpan(validationError *ErrResponse) otlpSpan {
+	exported := otlpSpan{
+		TraceId:           span.traceIdString(),
+		SpanId:            hex.EncodeToString(span.spanId[:]),
+		Name:              span.method + " " + span.endpoint,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: strconv.FormatInt(span.startTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.endTime.UnixNano(), 10),
+		Attributes: []otlpAttribute{
+			stringAttribute("http.request.method", span.method),
+			stringAttribute("url.full", span.url),
+			stringAttribute("load.phase", span.phase),
+			stringAttribute("load.endpoint", span.endpoint),
+			intAttribute("load.client_number", span.clientNumber),
+			intAttribute("load.message_number", span.messageNumber),
+		},
+		Status: otlpStatus{Code: otlpStatusCodeOk},
+	}
+
+	if span.endpoint == "/buy" {
+		exported.Attributes = append(exported.Attributes, intAttribute("load.item_number", span.itemNumber))
+	}
+	if span.statusCode > 0 {
+		exported.Attributes = append(exported.Attributes, intAttribute("http.response.status_code", span.statusCode))
+	}
+	if span.sendError != "" {
+		exported.Attributes = append(exported.Attributes, stringAttribute("error.type", span.sendError))
+	}
+
+	if validationError != nil {
+		exported.Attributes = append(exported.Attributes,
+			stringAttribute("load.validation_result", "invalid"),
+			stringAttribute("load.validation_error", validationError.message))
+		exported.Status = otlpStatus{Code: otlpStatusCodeError, Message: validationError.message}
+	} else {
+		exported.Attributes = append(exported.Attributes, stringAttribute("load.validation_result", "valid"))
+	}
+
+	return exported
+}
+
+// otlpExporter posts finished spans in batches to an OTLP/HTTP JSON traces endpoint of a collector
+type otlpExporter struct {
+	endpoint   string
+	httpClient *http.Client
+
+	spans        chan otlpSpan
+	droppedSpans uint64
+	done         chan struct{}
+}
+
+var spanExporter *otlpExporter
+
+func startSpanExporter(endpoint string) {
+	spanExporter = &otlpExporter{
+		endpoint:   endpoint,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		spans:      make(chan otlpSpan, otlpQueueSize),
+		done:       make(chan struct{}),
+	}
+	go spanExporter.run()
+}
+
+func stopSpanExporter() {
+	if spanExporter == nil {
+		return
+	}
+
+	close(spanExporter.spans)
+	<-spanExporter.done
+
+	if droppedSpans := atomic.LoadUint64(&spanExporter.droppedSpans); droppedSpans > 0 {
+		logStat.Printf("[MAIN] %d spans were not exported: the export queue was full", droppedSpans)
+	}
+	spanExporter = nil
+}
+
+// export queues the span without blocking the client, dropping it when the queue is full
+func (exporter *otlpExporter) export(span otlpSpan) {
+	select {
+	case exporter.spans <- span:
+	default:
+		atomic.AddUint64(&exporter.droppedSpans, 1)
+	}
+}
+
+func (exporter *otlpExporter) run() {
+	defer close(exporter.done)
+
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]otlpSpan, 0, otlpBatchSize)
+	for {
+		select {
+		case span, ok := <-exporter.spans:
+			if !ok {
+				exporter.send(batch)
+				return
+			}
+			if batch = append(batch, span); len(batch) >= otlpBatchSize {
+				exporter.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			exporter.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (exporter *otlpExporter) send(batch []otlpSpan) {
+	if len(batch) == 0 {
+		return
+	}
+
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{stringAttribute("service.name", "load-generator")},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "start_testing"},
+				"spans": batch,
+			}},
+		}},
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		logError.Printf("[MAIN] Unable to encode spans. Error: %s", err)
+		return
+	}
+
+	response, err := exporter.httpClient.Post(exporter.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		logError.Printf("[MAIN] Unable to export %d spans. Error: %s", len(batch), err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		logError.Printf("[MAIN] Unable to export %d spans. Error: unexpected status %s: %s",
+			len(batch), response.Status, bytes.TrimSpace(message))
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// transitionProbabilityTolerance is how far the transition probabilities of a state may add up from 1
+const transitionProbabilityTolerance = 1e-6
+
+// UserModel describes the virtual users as a Markov chain of states, such as get items, buy item and leave.
+// A session starts in the Initial state, or the first one. In a state the user sends the Steps of the state,
+// waits the ThinkTime and moves to one of the Transitions with its probability, the probabilities of a
+// state adding up to 1. A state without transitions ends the session, and so does a failed step.
+//
+// The states of a session share its variables, a variable extracted in a state that has not been visited
+// yet renders empty. Every session is one client message, so the sessions of a client are separated by the
+// send delay or think time of the phase.
+type UserModel struct {
+	Name    string      `json:"name,omitempty"`
+	Initial string      `json:"initial,omitempty"`
+	States  []UserState `json:"states"`
+}
+
+type UserState struct {
+	Name        string             `json:"name"`
+	Steps       []JourneyStep      `json:"steps,omitempty"`
+	ThinkTime   *distribution      `json:"thinkTime,omitempty"`
+	Transitions map[string]float64 `json:"transitions,omitempty"`
+}
+
+type compiledUserState struct {
+	name      string
+	steps     *compiledJourney
+	thinkTime distribution
+
+	// next and cumulativeProbabilities are ordered by the state name, so a seeded run walks the same states
+	next                    []int
+	cumulativeProbabilities []float64
+}
+
+type compiledUserModel struct {
+	name    string
+	initial int
+	states  []compiledUserState
+}
+
+var activeUserModel *compiledUserModel
+
+func compileUserModel(model *UserModel) (*compiledUserModel, error) {
+	if model == nil {
+		return nil, nil
+	}
+	if len(model.States) == 0 {
+		return nil, errors.New("user model: no states defined")
+	}
+
+	compiled := &compiledUserModel{name: model.Name}
+	if compiled.name == "" {
+		compiled.name = "user model"
+	}
+
+	stateIndexes := make(map[string]int)
+	definedVariables := builtInJourneyVariables()
+	for index, state := range model.States {
+		if state.Name == "" {
+			return nil, fmt.Errorf("user model, state %d: name is required", index)
+		}
+		if _, ok := stateIndexes[state.Name]; ok {
+			return nil, fmt.Errorf("user model, state %s: duplicate name", state.Name)
+		}
+		stateIndexes[state.Name] = index
+
+		for _, step := range state.Steps {
+			for _, extraction := range step.Extract {
+				definedVariables[extraction.Var] = true
+			}
+		}
+	}
+
+	for _, state := range model.States {
+		compiledState := compiledUserState{name: state.Name,
+			thinkTime: distribution{kind: distributionConstant, params: []time.Duration{0}}}
+		if state.ThinkTime != nil {
+			compiledState.thinkTime = *state.ThinkTime
+		}
+
+		if len(state.Steps) > 0 {
+			stateVariables := make(map[string]bool)
+			for variable := range definedVariables {
+				stateVariables[variable] = true
+			}
+			steps, err := compileJourney(Journey{Name: state.Name, Steps: state.Steps}, stateVariables)
+			if err != nil {
+				return nil, fmt.Errorf("user model: %s", err)
+			}
+			compiledState.steps = steps
+		}
+
+		targets := make([]string, 0, len(state.Transitions))
+		for target := range state.Transitions {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+
+		var totalProbability float64
+		for _, target := range targets {
+			probability := state.Transitions[target]
+			targetIndex, ok := stateIndexes[target]
+			if !ok {
+				return nil, fmt.Errorf("user model, state %s: transition to unknown state %q", state.Name, target)
+			}
+			if probability < 0 || probability > 1 {
+				return nil, fmt.Errorf("user model, state %s: probability of %s must be between 0 and 1", state.Name, target)
+			}
+			if probability == 0 {
+				continue
+			}
+			totalProbability += probability
+			compiledState.next = append(compiledState.next, targetIndex)
+			compiledState.cumulativeProbabilities = append(compiledState.cumulativeProbabilities, totalProbability)
+		}
+		if len(targets) > 0 && math.Abs(totalProbability-1) > transitionProbabilityTolerance {
+			return nil, fmt.Errorf("user model, state %s: transition probabilities add up to %v instead of 1",
+				state.Name, totalProbability)
+		}
+
+		compiled.states = append(compiled.states, compiledState)
+	}
+
+	if model.Initial != "" {
+		initial, ok := stateIndexes[model.Initial]
+		if !ok {
+			return nil, fmt.Errorf("user model: unknown initial state %q", model.Initial)
+		}
+		compiled.initial = initial
+	}
+
+	if state := compiled.endlessState(); state != "" {
+		return nil, fmt.Errorf("user model, state %s: no state without transitions can be reached, "+
+			"the session would never end", state)
+	}
+
+	return compiled, nil
+}
+
+// endlessState returns a state from which the session can never reach a state without transitions
+func (model *compiledUserModel) endlessState() string {
+	canEnd := make([]bool, len(model.states))
+	for changed := true; changed; {
+		changed = false
+		for index, state := range model.states {
+			if canEnd[index] {
+				continue
+			}
+			canEnd[index] = len(state.next) == 0
+			for _, next := range state.next {
+				canEnd[index] = canEnd[index] || canEnd[next]
+			}
+			changed = changed || canEnd[index]
+		}
+	}
+
+	for index, state := range model.states {
+		if !canEnd[index] {
+			return state.name
+		}
+	}
+	return ""
+}
+
+func setUserModel(model *UserModel) error {
+	compiled, err := compileUserModel(model)
+	if err != nil {
+		return err
+	}
+	activeUserModel = compiled
+	return nil
+}
+
+func (state compiledUserState) pickNext(clientRandom *rand.Rand) int {
+	point := clientRandom.Float64() * state.cumulativeProbabilities[len(state.cumulativeProbabilities)-1]
+	index := sort.SearchFloat64s(state.cumulativeProbabilities, point)
+	if index >= len(state.next) {
+		index = len(state.next) - 1
+	}
+	return state.next[index]
+}
+
+// runSession walks the states from the initial one as one client message, the session is recorded as
+// a journey named after the model and its duration includes the think times. The requests of every state
+// carry only the lateness of the schedule into their corrected response time, not the earlier states.
+func (model *compiledUserModel) runSession(userName, contentType string, currentClientNumber, currentMessageNumber int,
+	clientRandom *rand.Rand, schedule messageSchedule) {
+
+	startTime := time.Now()
+	variables := newJourneyVariables(userName, currentClientNumber, currentMessageNumber)
+
+	failureClass := ""
+	for stateIndex := model.initial; ; {
+		state := model.states[stateIndex]
+		failure := state.visit(variables, contentType, currentClientNumber, currentMessageNumber, clientRandom, schedule)
+		if failure != nil {
+			failureClass = failure.class
+			break
+		}
+		if len(state.next) == 0 {
+			break
+		}
+		stateIndex = state.pickNext(clientRandom)
+	}
+	duration := time.Since(startTime)
+
+	currentPhaseStats.recordJourney(model.name, duration, failureClass)
+	writeSample(sampleRecord{kind: sampleKindJourney, time: startTime, elapsed: duration, message: model.name,
+		errorClass: failureClass})
+}
+
+// visit sends the steps of the state, waits the think time of the state unless the session ends there and
+// records the visit. The latency of a visit covers its requests only, the dwell time is the whole time spent
+// in the state including the think times.
+func (state compiledUserState) visit(variables journeyVariables, contentType string, currentClientNumber,
+	currentMessageNumber int, clientRandom *rand.Rand, schedule messageSchedule) *ErrResponse {
+
+	startTime := time.Now()
+	var failure *ErrResponse
+	var stepsThinkTime time.Duration
+	if state.steps != nil {
+		failure, stepsThinkTime = state.steps.runSteps(variables, contentType, currentClientNumber, currentMessageNumber,
+			clientRandom, schedule)
+	}
+	latency := time.Since(startTime) - stepsThinkTime
+
+	if failure == nil && len(state.next) > 0 {
+		time.Sleep(state.thinkTime.sample(clientRandom))
+	}
+	dwellTime := time.Since(startTime)
+
+	failureClass := ""
+	if failure != nil {
+		failureClass = failure.class
+	}
+	currentPhaseStats.recordUserState(state.name, latency, dwellTime, failureClass)
+	writeSample(sampleRecord{kind: sampleKindUserState, time: startTime, elapsed: latency, dwellTime: dwellTime,
+		message: state.name, errorClass: failureClass})
+
+	return failure
+}
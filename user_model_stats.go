@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// recordUserState records a visit of a state, its latency covers the requests of the visit and its dwell
+// time the whole visit including the think times
+func (stats *phaseStats) recordUserState(name string, latency, dwellTime time.Duration, failureClass string) {
+	stats.muxJourneys.Lock()
+	defer stats.muxJourneys.Unlock()
+
+	recordJourneyRun(stats.userStates, name, latency, failureClass)
+
+	dwellTimes, ok := stats.userStateDwellTimes[name]
+	if !ok {
+		dwellTimes = newHistogram(histogramSignificantDigits)
+		stats.userStateDwellTimes[name] = dwellTimes
+	}
+	dwellTimes.record(dwellTime)
+}
+
+type userStateReport struct {
+	Name           string            `json:"name"`
+	Visits         uint64            `json:"visits"`
+	SharePercent   float64           `json:"sharePercent"`
+	Failed         uint64            `json:"failed"`
+	FailureClasses map[string]uint64 `json:"failureClasses"`
+	Latency        latencyReport     `json:"latency"`
+	DwellTime      latencyReport     `json:"dwellTime"`
+}
+
+func (stats *phaseStats) userStateReports() []userStateReport {
+	stats.muxJourneys.Lock()
+	defer stats.muxJourneys.Unlock()
+
+	var reports []userStateReport
+	for _, visits := range journeyRunReports(stats.userStates) {
+		dwellTimes, ok := stats.userStateDwellTimes[visits.Name]
+		if !ok {
+			dwellTimes = newHistogram(histogramSignificantDigits)
+		}
+		reports = append(reports, userStateReport{
+			Name:           visits.Name,
+			Visits:         visits.Runs,
+			SharePercent:   visits.SharePercent,
+			Failed:         visits.Failed,
+			FailureClasses: visits.FailureClasses,
+			Latency:        visits.Duration,
+			DwellTime:      newLatencyReport(dwellTimes),
+		})
+	}
+	return reports
+}
+
+func showUserStateStat(stats *phaseStats) {
+	reports := stats.userStateReports()
+	if len(reports) == 0 {
+		return
+	}
+
+	logStat.Print("User model state statistics:")
+
+	header := "State	Visits	Share of visits in %	Failed	Average latency in ms"
+	for _, percentile := range reportPercentiles {
+		header += "	" + percentileName(percentile) + " percentile in ms"
+	}
+	logStat.Print(header + "	Max in ms	Average dwell time in ms	Max dwell time in ms")
+
+	for _, report := range reports {
+		row := fmt.Sprintf("%s	%d	%f	%d	%f", report.Name, report.Visits, report.SharePercent,
+			report.Failed, report.Latency.MeanMs)
+		for _, percentile := range reportPercentiles {
+			row += fmt.Sprintf("	%f", report.Latency.Percentiles[percentileKey(percentile)])
+		}
+		logStat.Printf("%s	%f	%f	%f", row, report.Latency.MaxMs, report.DwellTime.MeanMs, report.DwellTime.MaxMs)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestUserModelStatesAreMeasuredWithoutEarlierStatesAndThinkTimes(t *testing.T) {
+	startIdleTestShop(t)
+
+	browse := JourneyStep{Endpoint: "/", Query: "name=${clientName}", OracleName: "${clientName}"}
+	model, err := compileUserModel(&UserModel{Name: "browser", States: []UserState{
+		{Name: "browse", Steps: []JourneyStep{browse},
+			ThinkTime:   &distribution{kind: distributionConstant, params: []time.Duration{20 * time.Millisecond}},
+			Transitions: map[string]float64{"browse again": 1}},
+		{Name: "browse again", Steps: []JourneyStep{browse}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intendedTime := time.Now()
+	model.runSession("ticketbright", "application/x-www-form-urlencoded", 0, 0, rand.New(rand.NewSource(1)),
+		arrivalRateIteration{intendedTime: intendedTime}.schedule(intendedTime))
+
+	if count := currentPhaseStats.endpoint("/").responseTime.count(); count != 2 {
+		t.Fatalf("the session sent %d requests, expected 2", count)
+	}
+	checkCorrectedEqualsRaw(t, "/")
+
+	currentPhaseStats = newPhaseStats("late", time.Now())
+	model.runSession("ticketbright", "application/x-www-form-urlencoded", 0, 1, rand.New(rand.NewSource(1)),
+		arrivalRateIteration{intendedTime: intendedTime}.schedule(intendedTime.Add(100*time.Millisecond)))
+
+	endpoint := currentPhaseStats.endpoint("/")
+	if lateness := endpoint.correctedResponseTime.max() - endpoint.responseTime.max(); lateness > 101*time.Millisecond {
+		t.Errorf("the corrected response time of the second state includes the first one: %v more than raw", lateness)
+	}
+}
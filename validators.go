@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	validatorExact      = "exact"
+	validatorJsonEqual  = "json-equal"
+	validatorJsonSchema = "json-schema"
+	validatorJsonPath   = "jsonpath"
+	validatorRegex      = "regex"
+	validatorStatus     = "status"
+	validatorHeader     = "header"
+
+	errorClassSchemaViolation = "schema_violation"
+	errorClassAssertionFailed = "assertion_failed"
+	errorClassHeaderMismatch  = "header_mismatch"
+
+	// errorClassValidatorFailed is a response the validator could not check, such as one whose expected
+	// body is not JSON, so it is not blamed on the transport
+	errorClassValidatorFailed = "validator_failed"
+)
+
+// validatedResponse is a received response together with the body the built-in oracle expects for it
+type validatedResponse struct {
+	statusCode int
+	header     http.Header
+	body       string
+	expected   string
+}
+
+// Validator checks a response of an endpoint, a failed check is returned as a *validationError
+type Validator interface {
+	Validate(response validatedResponse) error
+}
+
+type validationError struct {
+	class   string
+	message string
+}
+
+func (err *validationError) Error() string {
+	return err.message
+}
+
+// ValidatorSpec configures a validator of an endpoint in the scenario file, for example
+//
+//	"validators": {"/buy": [{"type": "status", "codes": [200]}, {"type": "json-equal"}]}
+//
+// Unless an endpoint lists a status validator, its responses must have the status 200.
+type ValidatorSpec struct {
+	Type       string              `json:"type"`
+	Codes      []int               `json:"codes,omitempty"`
+	Header     string              `json:"header,omitempty"`
+	Pattern    string              `json:"pattern,omitempty"`
+	Expected   json.RawMessage     `json:"expected,omitempty"`
+	Schema     json.RawMessage     `json:"schema,omitempty"`
+	Assertions []JsonPathAssertion `json:"assertions,omitempty"`
+}
+
+var endpointValidators = defaultValidators()
+
+func defaultValidators() map[string][]Validator {
+	validators := make(map[string][]Validator)
+	for _, endpoint := range testedEndpoints {
+		validators[endpoint] = []Validator{statusValidator{codes: []int{http.StatusOK}}, exactValidator{}}
+	}
+	return validators
+}
+
+func buildValidators(specs map[string][]ValidatorSpec) (map[string][]Validator, error) {
+	validators := defaultValidators()
+
+	endpoints := make([]string, 0, len(specs))
+	for endpoint := range specs {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	for _, endpoint := range endpoints {
+		if !strings.HasPrefix(endpoint, "/") {
+			return nil, fmt.Errorf("validators: invalid endpoint %q, a path starting with / is expected", endpoint)
+		}
+		_, hasOracle := endpointOracles[endpoint]
+
+		var endpointValidators []Validator
+		hasStatusValidator := false
+		for index, spec := range specs[endpoint] {
+			validator, err := spec.validator()
+			if err != nil {
+				return nil, fmt.Errorf("validators of %s, validator %d: %s", endpoint, index, err)
+			}
+			if !hasOracle && spec.needsOracle() {
+				return nil, fmt.Errorf("validators of %s, validator %d: the endpoint has no built-in expected response, "+
+					"an expected value is required", endpoint, index)
+			}
+			endpointValidators = append(endpointValidators, validator)
+			hasStatusValidator = hasStatusValidator || spec.Type == validatorStatus
+		}
+
+		if !hasStatusValidator {
+			endpointValidators = append([]Validator{statusValidator{codes: []int{http.StatusOK}}}, endpointValidators...)
+		}
+		validators[endpoint] = endpointValidators
+	}
+
+	return validators, nil
+}
+
+// validatorsOf returns the validators of an endpoint, an endpoint without validators only needs the status 200
+func validatorsOf(endpoint string) []Validator {
+	if validators, ok := endpointValidators[endpoint]; ok {
+		return validators
+	}
+	return []Validator{statusValidator{codes: []int{http.StatusOK}}}
+}
+
+func setValidators(specs map[string][]ValidatorSpec) error {
+	validators, err := buildValidators(specs)
+	if err != nil {
+		return err
+	}
+	endpointValidators = validators
+	return nil
+}
+
+// needsOracle tells whether the validator compares the response with the built-in expected response
+func (spec ValidatorSpec) needsOracle() bool {
+	return spec.Type == validatorExact || (spec.Type == validatorJsonEqual && len(spec.Expected) == 0)
+}
+
+func (spec ValidatorSpec) validator() (Validator, error) {
+	switch spec.Type {
+	case validatorExact:
+		return exactValidator{}, nil
+	case validatorJsonEqual:
+		validator := jsonEqualValidator{}
+		if len(spec.Expected) > 0 {
+			if err := json.Unmarshal(spec.Expected, &validator.expected); err != nil {
+				return nil, fmt.Errorf("invalid expected value: %s", err)
+			}
+			validator.hasExpected = true
+		}
+		return validator, nil
+	case validatorJsonSchema:
+		if len(spec.Schema) == 0 {
+			return nil, errors.New("schema is required")
+		}
+		schema, err := parseJsonSchema(spec.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema: %s", err)
+		}
+		return jsonSchemaValidator{schema: schema}, nil
+	case validatorJsonPath:
+		if len(spec.Assertions) == 0 {
+			return nil, errors.New("at least one assertion is required")
+		}
+		validator := jsonPathValidator{}
+		for _, assertion := range spec.Assertions {
+			compiled, err := assertion.compile()
+			if err != nil {
+				return nil, err
+			}
+			validator.assertions = append(validator.assertions, compiled)
+		}
+		return validator, nil
+	case validatorRegex:
+		pattern, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %s", err)
+		}
+		return regexValidator{pattern: pattern}, nil
+	case validatorStatus:
+		if len(spec.Codes) == 0 {
+			return nil, errors.New("at least one status code is required")
+		}
+		return statusValidator{codes: spec.Codes}, nil
+	case validatorHeader:
+		if spec.Header == "" {
+			return nil, errors.New("header is required")
+		}
+		pattern, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %s", err)
+		}
+		return headerValidator{name: spec.Header, pattern: pattern}, nil
+	}
+	return nil, fmt.Errorf("unknown validator type %q", spec.Type)
+}
+
+// exactValidator is the original oracle: the body must be byte for byte the expected response
+type exactValidator struct{}
+
+func (exactValidator) Validate(response validatedResponse) error {
+	if response.body == response.expected {
+		return nil
+	}
+
+	class := errorClassBodyMismatch
+	if !json.Valid([]byte(response.body)) {
+		class = errorClassJsonParse
+	}
+	return &validationError{class: class,
+		message: "wrong response body: " + response.body + " | Expected: " + response.expected}
+}
+
+// jsonEqualValidator compares the decoded bodies, so key order and whitespace do not matter
+type jsonEqualValidator struct {
+	expected    interface{}
+	hasExpected bool
+}
+
+func decodeJsonBody(body string) (interface{}, error) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+		return nil, &validationError{class: errorClassJsonParse, message: "invalid JSON response body: " + err.Error()}
+	}
+	return decoded, nil
+}
+
+func (validator jsonEqualValidator) Validate(response validatedResponse) error {
+	body, err := decodeJsonBody(response.body)
+	if err != nil {
+		return err
+	}
+
+	expected, expectedBody := validator.expected, response.expected
+	if validator.hasExpected {
+		encodedExpected, _ := json.Marshal(expected)
+		expectedBody = string(encodedExpected)
+	} else if err := json.Unmarshal([]byte(response.expected), &expected); err != nil {
+		return &validationError{class: errorClassValidatorFailed, message: "invalid expected response: " + err.Error()}
+	}
+
+	if !reflect.DeepEqual(body, expected) {
+		return &validationError{class: errorClassBodyMismatch,
+			message: "wrong response body: " + response.body + " | Expected: " + expectedBody}
+	}
+	return nil
+}
+
+type jsonSchemaValidator struct {
+	schema *jsonSchema
+}
+
+func (validator jsonSchemaValidator) Validate(response validatedResponse) error {
+	body, err := decodeJsonBody(response.body)
+	if err != nil {
+		return err
+	}
+
+	if err := validator.schema.validate(body, "$"); err != nil {
+		return &validationError{class: errorClassSchemaViolation, message: "schema violation: " + err.Error()}
+	}
+	return nil
+}
+
+type jsonPathValidator struct {
+	assertions []jsonPathAssertion
+}
+
+func (validator jsonPathValidator) Validate(response validatedResponse) error {
+	body, err := decodeJsonBody(response.body)
+	if err != nil {
+		return err
+	}
+
+	for _, assertion := range validator.assertions {
+		if err := assertion.check(body); err != nil {
+			return &validationError{class: errorClassAssertionFailed, message: "assertion failed: " + err.Error()}
+		}
+	}
+	return nil
+}
+
+type regexValidator struct {
+	pattern *regexp.Regexp
+}
+
+func (validator regexValidator) Validate(response validatedResponse) error {
+	if !validator.pattern.MatchString(response.body) {
+		return &validationError{class: errorClassBodyMismatch,
+			message: "wrong response body: " + response.body + " | Expected to match: " + validator.pattern.String()}
+	}
+	return nil
+}
+
+type statusValidator struct {
+	codes []int
+}
+
+func (validator statusValidator) Validate(response validatedResponse) error {
+	for _, code := range validator.codes {
+		if response.statusCode == code {
+			return nil
+		}
+	}
+	return &validationError{class: statusErrorClass(response.statusCode),
+		message: "wrong status code: " + strconv.Itoa(response.statusCode)}
+}
+
+// headerValidator requires a header whose value matches the pattern, an empty pattern only requires the header
+type headerValidator struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+func (validator headerValidator) Validate(response validatedResponse) error {
+	values, ok := response.header[http.CanonicalHeaderKey(validator.name)]
+	if !ok {
+		return &validationError{class: errorClassHeaderMismatch, message: "missing header: " + validator.name}
+	}
+
+	value := strings.Join(values, ", ")
+	if !validator.pattern.MatchString(value) {
+		return &validationError{class: errorClassHeaderMismatch,
+			message: "wrong header " + validator.name + ": " + value + " | Expected to match: " + validator.pattern.String()}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckResponseClassesValidatorFailures(t *testing.T) {
+	validators, err := buildValidators(map[string][]ValidatorSpec{"/": {{Type: validatorJsonEqual}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous map[string][]Validator) { endpointValidators = previous }(endpointValidators)
+	endpointValidators = validators
+
+	tests := []struct {
+		body     string
+		expected string
+		class    string
+	}{
+		{body: `{"items":[]}`, expected: `{"items": []}`},
+		{body: `{"items":[1]}`, expected: `{"items":[]}`, class: errorClassBodyMismatch},
+		{body: `{"items"`, expected: `{"items":[]}`, class: errorClassJsonParse},
+		{body: `{"items":[]}`, expected: `not json`, class: errorClassValidatorFailed},
+	}
+
+	for _, test := range tests {
+		errResponse := checkResponse("/", "", requestResult{statusCode: 200, body: test.body},
+			func(string) string { return test.expected })
+
+		class := ""
+		if errResponse != nil {
+			class = errResponse.class
+		}
+		if class != test.class {
+			t.Errorf("body %s expected as %s is classed %q, expected %q", test.body, test.expected, class, test.class)
+		}
+	}
+}
+
+func TestBuildValidatorsRejectsInvalidExpectedValue(t *testing.T) {
+	specs := map[string][]ValidatorSpec{"/buy": {{Type: validatorJsonEqual, Expected: json.RawMessage(`{"result"`)}}}
+	if _, err := buildValidators(specs); err == nil {
+		t.Error("an invalid expected value was accepted")
+	}
+}
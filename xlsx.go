@@ -0,0 +1,220 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The workbook is written as a minimal Office Open XML package: one worksheet per statistic table,
+// numbers as numeric cells and text as inline strings, so no shared strings table is needed.
+
+const xlsxMaxSheetNameLength = 31
+
+func writeXlsxReport(report *runReport, reportDir string) error {
+	tables := reportTables(report)
+
+	reportPath := filepath.Join(reportDir, "Report.xlsx")
+	if len(tables) == 0 {
+		// a workbook needs at least one sheet, a report of an earlier run must not be taken for this one
+		os.Remove(reportPath)
+		logStat.Print("[MAIN] XLSX report has not been written: no phase shows its statistics")
+		return nil
+	}
+
+	outfile, err := os.Create(reportPath)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(outfile)
+
+	sheetNames := make([]string, len(tables))
+	usedSheetNames := make(map[string]bool)
+	for index, table := range tables {
+		sheetNames[index] = uniqueSheetName(fmt.Sprintf("Phase %d %s", table.phaseNumber, table.statistic), usedSheetNames)
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes(len(tables))},
+		{"_rels/.rels", xlsxRootRelationships},
+		{"xl/workbook.xml", xlsxWorkbook(sheetNames)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRelationships(len(tables))},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for index, table := range tables {
+		files = append(files, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", index+1), xlsxWorksheet(table)})
+	}
+
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err == nil {
+			_, err = writer.Write([]byte(file.content))
+		}
+		if err != nil {
+			archive.Close()
+			outfile.Close()
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		outfile.Close()
+		return err
+	}
+	if err := outfile.Close(); err != nil {
+		return err
+	}
+
+	logStat.Printf("[MAIN] XLSX report has been written to %s", reportPath)
+	return nil
+}
+
+func uniqueSheetName(name string, usedSheetNames map[string]bool) string {
+	name = strings.Map(func(char rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, char) {
+			return '_'
+		}
+		return char
+	}, name)
+
+	if len(name) > xlsxMaxSheetNameLength {
+		name = name[:xlsxMaxSheetNameLength]
+	}
+
+	uniqueName := name
+	for suffix := 2; usedSheetNames[strings.ToLower(uniqueName)]; suffix++ {
+		suffixString := fmt.Sprintf(" (%d)", suffix)
+		if len(name)+len(suffixString) > xlsxMaxSheetNameLength {
+			uniqueName = name[:xlsxMaxSheetNameLength-len(suffixString)] + suffixString
+		} else {
+			uniqueName = name + suffixString
+		}
+	}
+
+	usedSheetNames[strings.ToLower(uniqueName)] = true
+	return uniqueName
+}
+
+func xlsxEscape(text string) string {
+	buffer := &bytes.Buffer{}
+	xml.EscapeText(buffer, []byte(text))
+	return buffer.String()
+}
+
+func xlsxColumnName(columnIndex int) string {
+	name := ""
+	for columnIndex++; columnIndex > 0; columnIndex = (columnIndex - 1) / 26 {
+		name = string(rune('A'+(columnIndex-1)%26)) + name
+	}
+	return name
+}
+
+func xlsxWorksheet(table statisticTable) string {
+	sheet := &strings.Builder{}
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sheet.WriteString(`<cols><col min="1" max="1" width="12" customWidth="1"/><col min="2" max="2" width="40" customWidth="1"/></cols>`)
+	sheet.WriteString("<sheetData>")
+
+	writeTextRow := func(rowNumber int, values []string) {
+		fmt.Fprintf(sheet, `<row r="%d">`, rowNumber)
+		for columnIndex, value := range values {
+			fmt.Fprintf(sheet, `<c r="%s%d" t="inlineStr"><is><t>%s</t></is></c>`,
+				xlsxColumnName(columnIndex), rowNumber, xlsxEscape(value))
+		}
+		sheet.WriteString("</row>")
+	}
+
+	writeTextRow(1, []string{table.phaseName})
+	writeTextRow(2, table.header)
+
+	for rowIndex, row := range table.rows {
+		rowNumber := rowIndex + 3
+		fmt.Fprintf(sheet, `<row r="%d">`, rowNumber)
+		firstValueColumn := 0
+		if table.rowLabels != nil {
+			fmt.Fprintf(sheet, `<c r="A%d" t="inlineStr"><is><t>%s</t></is></c>`, rowNumber, xlsxEscape(table.rowLabels[rowIndex]))
+			firstValueColumn = 1
+		}
+		for columnIndex, value := range row {
+			// a numeric cell holds finite numbers only, NaN and infinities are left empty
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				fmt.Fprintf(sheet, `<c r="%s%d"/>`, xlsxColumnName(firstValueColumn+columnIndex), rowNumber)
+				continue
+			}
+			fmt.Fprintf(sheet, `<c r="%s%d"><v>%s</v></c>`,
+				xlsxColumnName(firstValueColumn+columnIndex), rowNumber, formatTableValue(value))
+		}
+		sheet.WriteString("</row>")
+	}
+
+	sheet.WriteString("</sheetData></worksheet>")
+	return sheet.String()
+}
+
+func xlsxContentTypes(sheetsNum int) string {
+	contentTypes := &strings.Builder{}
+	contentTypes.WriteString(xml.Header)
+	contentTypes.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	contentTypes.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	contentTypes.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for sheetNumber := 1; sheetNumber <= sheetsNum; sheetNumber++ {
+		fmt.Fprintf(contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, sheetNumber)
+	}
+	contentTypes.WriteString("</Types>")
+	return contentTypes.String()
+}
+
+const xlsxRootRelationships = xml.Header +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxStyles = xml.Header +
+	`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/></cellXfs>` +
+	`</styleSheet>`
+
+func xlsxWorkbook(sheetNames []string) string {
+	workbook := &strings.Builder{}
+	workbook.WriteString(xml.Header)
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for index, sheetName := range sheetNames {
+		fmt.Fprintf(workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sheetName), index+1, index+1)
+	}
+	workbook.WriteString("</sheets></workbook>")
+	return workbook.String()
+}
+
+func xlsxWorkbookRelationships(sheetsNum int) string {
+	relationships := &strings.Builder{}
+	relationships.WriteString(xml.Header)
+	relationships.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for sheetNumber := 1; sheetNumber <= sheetsNum; sheetNumber++ {
+		fmt.Fprintf(relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`,
+			sheetNumber, sheetNumber)
+	}
+	fmt.Fprintf(relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`,
+		sheetsNum+1)
+	relationships.WriteString("</Relationships>")
+	return relationships.String()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestXlsxWorksheetLeavesNonFiniteCellsEmpty(t *testing.T) {
+	table := statisticTable{phaseNumber: 1, phaseName: "Ramp up", statistic: "Response time",
+		header: []string{"Clients", "Mean", "Max"}, rows: [][]float64{{10, math.NaN(), math.Inf(1)}, {20, 1.5, math.Inf(-1)}}}
+
+	sheet := xlsxWorksheet(table)
+
+	decoder := xml.NewDecoder(strings.NewReader(sheet))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("the worksheet is not valid XML: %s", err)
+		}
+	}
+	for _, cell := range []string{`<c r="B3"/>`, `<c r="C3"/>`, `<c r="C4"/>`, `<c r="B4"><v>1.5</v></c>`} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("the worksheet has no %s cell", cell)
+		}
+	}
+}
+
+func TestXlsxReportIsNotWrittenWithoutSheets(t *testing.T) {
+	directory := t.TempDir()
+	if err := openLogs(directory); err != nil {
+		t.Fatal(err)
+	}
+	defer closeLogs()
+
+	reportPath := filepath.Join(directory, "Report.xlsx")
+	if err := ioutil.WriteFile(reportPath, []byte("an earlier run"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := &runReport{Phases: []phaseReport{{Name: "Warm up", ShowStat: false}}}
+	if err := writeXlsxReport(report, directory); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(reportPath); !os.IsNotExist(err) {
+		t.Errorf("a workbook without sheets was left at %s", reportPath)
+	}
+}